@@ -6,8 +6,11 @@ import (
 	"fmt"
 	"image/color"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -30,7 +33,7 @@ func checkFile(filePath string) error {
 	return nil
 }
 
-func makeThrouputAnalysis(grouped map[string][]Summary, colors []color.Color) {
+func makeThrouputAnalysis(grouped map[string][]Summary, colors []color.Color, knees map[string]Knee) {
 	p2 := plot.New()
 	p2.Title.Text = "Throughput Analysis"
 	p2.X.Label.Text = "Offered Load (req/s)"
@@ -38,7 +41,8 @@ func makeThrouputAnalysis(grouped map[string][]Summary, colors []color.Color) {
 	p2.Add(plotter.NewGrid())
 
 	i := 0
-	for op, list := range grouped {
+	for _, op := range operations(grouped) {
+		list := grouped[op]
 		points := make(plotter.XYs, len(list))
 		for j, s := range list {
 			points[j].X, points[j].Y = float64(s.Rate), s.Throughput
@@ -47,6 +51,7 @@ func makeThrouputAnalysis(grouped map[string][]Summary, colors []color.Color) {
 		line.Color = colors[i%len(colors)]
 		p2.Add(line)
 		p2.Legend.Add(op, line)
+		addKneeMark(p2, knees[op], list, line.Color, func(s Summary) float64 { return s.Throughput })
 		i++
 	}
 
@@ -59,7 +64,7 @@ func makeThrouputAnalysis(grouped map[string][]Summary, colors []color.Color) {
 	fmt.Println("Saved: throughput_analysis.png")
 }
 
-func makeAvgLoadLatency(grouped map[string][]Summary, colors []color.Color) {
+func makeAvgLoadLatency(grouped map[string][]Summary, colors []color.Color, knees map[string]Knee) {
 	p := plot.New()
 	p.Title.Text = "Load-Latency Curve (Average)"
 	p.X.Label.Text = "Request Rate (req/s)"
@@ -67,7 +72,8 @@ func makeAvgLoadLatency(grouped map[string][]Summary, colors []color.Color) {
 	p.Add(plotter.NewGrid())
 
 	i := 0
-	for op, list := range grouped {
+	for _, op := range operations(grouped) {
+		list := grouped[op]
 		avg := make(plotter.XYs, len(list))
 		for j, s := range list {
 			avg[j].X, avg[j].Y = float64(s.Rate), s.AvgLatency
@@ -82,6 +88,7 @@ func makeAvgLoadLatency(grouped map[string][]Summary, colors []color.Color) {
 		p.Add(lineAvg)
 		p.Legend.Add(op, lineAvg)
 
+		addKneeMark(p, knees[op], list, col, func(s Summary) float64 { return s.AvgLatency })
 		i++
 	}
 	p.Legend.Top = true
@@ -93,7 +100,7 @@ func makeAvgLoadLatency(grouped map[string][]Summary, colors []color.Color) {
 	fmt.Println("Saved: load_latency_avg_curve.png")
 }
 
-func makeP95LoadLatency(grouped map[string][]Summary, colors []color.Color) {
+func makeP95LoadLatency(grouped map[string][]Summary, colors []color.Color, knees map[string]Knee) {
 	p := plot.New()
 	p.Title.Text = "Load-Latency Curve (P95)"
 	p.X.Label.Text = "Request Rate (req/s)"
@@ -101,7 +108,8 @@ func makeP95LoadLatency(grouped map[string][]Summary, colors []color.Color) {
 	p.Add(plotter.NewGrid())
 
 	i := 0
-	for op, list := range grouped {
+	for _, op := range operations(grouped) {
+		list := grouped[op]
 		p95 := make(plotter.XYs, len(list))
 		for j, s := range list {
 			p95[j].X, p95[j].Y = float64(s.Rate), s.P95Latency
@@ -115,7 +123,9 @@ func makeP95LoadLatency(grouped map[string][]Summary, colors []color.Color) {
 		lineP95.Dashes = []vg.Length{}
 		p.Add(lineP95)
 		p.Legend.Add(op, lineP95)
+		addCorrectedLine(p, op, list, col, func(s Summary) float64 { return s.CorrectedP95 })
 
+		addKneeMark(p, knees[op], list, col, func(s Summary) float64 { return s.P95Latency })
 		i++
 	}
 	p.Legend.Top = true
@@ -128,7 +138,7 @@ func makeP95LoadLatency(grouped map[string][]Summary, colors []color.Color) {
 
 }
 
-func makeP99LoadLatency(grouped map[string][]Summary, colors []color.Color) {
+func makeP99LoadLatency(grouped map[string][]Summary, colors []color.Color, knees map[string]Knee) {
 	p := plot.New()
 	p.Title.Text = "Load-Latency Curve (P99)"
 	p.X.Label.Text = "Request Rate (req/s)"
@@ -136,7 +146,8 @@ func makeP99LoadLatency(grouped map[string][]Summary, colors []color.Color) {
 	p.Add(plotter.NewGrid())
 
 	i := 0
-	for op, list := range grouped {
+	for _, op := range operations(grouped) {
+		list := grouped[op]
 		p99 := make(plotter.XYs, len(list))
 		for j, s := range list {
 			p99[j].X, p99[j].Y = float64(s.Rate), s.P99Latency
@@ -150,7 +161,9 @@ func makeP99LoadLatency(grouped map[string][]Summary, colors []color.Color) {
 		lineP99.Dashes = []vg.Length{}
 		p.Add(lineP99)
 		p.Legend.Add(op, lineP99)
+		addCorrectedLine(p, op, list, col, func(s Summary) float64 { return s.CorrectedP99 })
 
+		addKneeMark(p, knees[op], list, col, func(s Summary) float64 { return s.P99Latency })
 		i++
 	}
 	p.Legend.Top = true
@@ -163,7 +176,7 @@ func makeP99LoadLatency(grouped map[string][]Summary, colors []color.Color) {
 
 }
 
-func makeP50LoadLatency(grouped map[string][]Summary, colors []color.Color) {
+func makeP50LoadLatency(grouped map[string][]Summary, colors []color.Color, knees map[string]Knee) {
 	p := plot.New()
 	p.Title.Text = "Load-Latency Curve (P50)"
 	p.X.Label.Text = "Request Rate (req/s)"
@@ -171,7 +184,8 @@ func makeP50LoadLatency(grouped map[string][]Summary, colors []color.Color) {
 	p.Add(plotter.NewGrid())
 
 	i := 0
-	for op, list := range grouped {
+	for _, op := range operations(grouped) {
+		list := grouped[op]
 		p50 := make(plotter.XYs, len(list))
 		for j, s := range list {
 			p50[j].X, p50[j].Y = float64(s.Rate), s.P50Latency
@@ -185,7 +199,9 @@ func makeP50LoadLatency(grouped map[string][]Summary, colors []color.Color) {
 		lineP50.Dashes = []vg.Length{}
 		p.Add(lineP50)
 		p.Legend.Add(op, lineP50)
+		addCorrectedLine(p, op, list, col, func(s Summary) float64 { return s.CorrectedP50 })
 
+		addKneeMark(p, knees[op], list, col, func(s Summary) float64 { return s.P50Latency })
 		i++
 	}
 	p.Legend.Top = true
@@ -198,43 +214,40 @@ func makeP50LoadLatency(grouped map[string][]Summary, colors []color.Color) {
 
 }
 
+// addCorrectedLine draws the coordinated omission corrected percentile as a dashed line in the same color,
+// result files written before the corrected percentiles were recorded have none to draw
+func addCorrectedLine(p *plot.Plot, op string, list []Summary, col color.Color, corrected func(Summary) float64) {
+	points := make(plotter.XYs, 0, len(list))
+	for _, s := range list {
+		if corrected(s) > 0 {
+			points = append(points, plotter.XY{X: float64(s.Rate), Y: corrected(s)})
+		}
+	}
+	if len(points) == 0 {
+		return
+	}
+
+	line, _ := plotter.NewLine(points)
+	line.Color = col
+	line.Width = vg.Points(1.2)
+	line.Dashes = []vg.Length{vg.Points(4), vg.Points(2)}
+	p.Add(line)
+	p.Legend.Add(op+" (corrected)", line)
+}
+
 /*
 This shows the distribution/ skew of goroutine statup overhead, the diffences
 between being set ot created and set to executed
 */
-func makeCreationLatencyHistogram(data []SchedEvent, timeframes []Timeframe) {
-	creation := make(map[int64]int64)
-	firstExec := make(map[int64]int64)
-	for i := 0; i < len(data); i++ {
-		ev := data[i]
-		if !withinTimeframe(ev.Timestamp, timeframes) {
-			continue
-		}
-		switch ev.ActionID {
-		case GOROUTINE_CREATION:
-			if _, exists := creation[ev.GoRoutineID]; !exists {
-				creation[ev.GoRoutineID] = ev.Timestamp
-			}
-		case GOROUTINE_EXECUTION:
-			if _, exists := firstExec[ev.GoRoutineID]; !exists {
-				firstExec[ev.GoRoutineID] = ev.Timestamp
-			}
-		}
-
-	}
-
-	// Compute latencies
-	latencies := []float64{}
-	for gid, c := range creation {
-		if s, ok := firstExec[gid]; ok && s > c {
-			// convert ns --> microseconds
-			latency := float64(s-c) / 1000.0
-			latencies = append(latencies, latency)
-		}
+func makeCreationLatencyHistogram(data []SchedEvent, timeframes []Timeframe, phase string) {
+	latencies := creationLatencies(data, timeframes)
+	if len(latencies) == 0 {
+		log.Println("No goroutine creation latencies in timeframe!")
+		return
 	}
 
 	p := plot.New()
-	p.Title.Text = "Goroutine Creation Latency (PDF)"
+	p.Title.Text = phaseTitle("Goroutine Creation Latency (PDF)", phase)
 	p.X.Label.Text = "Latency (µs)"
 	p.Y.Label.Text = "Frequency"
 
@@ -261,7 +274,7 @@ func makeCreationLatencyHistogram(data []SchedEvent, timeframes []Timeframe) {
 	hist.Normalize(1) // convert to probability density
 	p.Add(hist)
 
-	if err := p.Save(9*vg.Inch, 5*vg.Inch, "goroutine_creation_latency_hist.png"); err != nil {
+	if err := p.Save(9*vg.Inch, 5*vg.Inch, phaseFile("goroutine_creation_latency_hist.png", phase)); err != nil {
 		log.Fatal(err)
 	}
 
@@ -270,35 +283,11 @@ func makeCreationLatencyHistogram(data []SchedEvent, timeframes []Timeframe) {
 /**
 *	This gives some insight into the tail latencies of Goroutine creation
  */
-func makeCreationLatencyCDF(data []SchedEvent, timeframes []Timeframe) {
-	creation := make(map[int64]int64)
-	firstExec := make(map[int64]int64)
-	for i := 0; i < len(data); i++ {
-		ev := data[i]
-		if !withinTimeframe(ev.Timestamp, timeframes) {
-			continue
-		}
-		switch ev.ActionID {
-		case GOROUTINE_CREATION:
-			if _, exists := creation[ev.GoRoutineID]; !exists {
-				creation[ev.GoRoutineID] = ev.Timestamp
-			}
-		case GOROUTINE_EXECUTION:
-			if _, exists := firstExec[ev.GoRoutineID]; !exists {
-				firstExec[ev.GoRoutineID] = ev.Timestamp
-			}
-		}
-
-	}
-
-	// Compute latencies
-	latencies := []float64{}
-	for gid, c := range creation {
-		if s, ok := firstExec[gid]; ok && s > c {
-			// convert ns --> microseconds
-			latency := float64(s-c) / 1000.0
-			latencies = append(latencies, latency)
-		}
+func makeCreationLatencyCDF(data []SchedEvent, timeframes []Timeframe, phase string) {
+	latencies := creationLatencies(data, timeframes)
+	if len(latencies) == 0 {
+		log.Println("No goroutine creation latencies in timeframe!")
+		return
 	}
 
 	sort.Float64s(latencies)
@@ -311,7 +300,7 @@ func makeCreationLatencyCDF(data []SchedEvent, timeframes []Timeframe) {
 	}
 
 	p := plot.New()
-	p.Title.Text = "Goroutine Creation Latency (CDF)"
+	p.Title.Text = phaseTitle("Goroutine Creation Latency (CDF)", phase)
 	p.X.Label.Text = "Latency (µs)"
 	p.Y.Label.Text = "P(Latency ≤ x)"
 
@@ -322,46 +311,16 @@ func makeCreationLatencyCDF(data []SchedEvent, timeframes []Timeframe) {
 
 	p.Add(line)
 
-	if err := p.Save(8*vg.Inch, 5*vg.Inch, "goroutine_creation_latency_cdf.png"); err != nil {
+	if err := p.Save(8*vg.Inch, 5*vg.Inch, phaseFile("goroutine_creation_latency_cdf.png", phase)); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func makeSchedulingLatencyCDF(data []ChangeEvent, timeframes []Timeframe) {
-	states := make(map[int64]*GState)
-
-	// All collected latencies
-	var latencies []float64
-
-	for _, ev := range data {
-		if !withinTimeframe(ev.Timestamp, timeframes) {
-			continue
-		}
-
-		gid := ev.GoRoutineID
-		st, exists := states[gid]
-		if !exists {
-			st = &GState{}
-			states[gid] = st
-		}
-
-		switch gstatus(ev.NewStatus) {
-
-		case GRUNNABLE:
-			// record a new READY; discard any stale READY/RUNNING
-			st.lastReady = ev.Timestamp
-			st.hasReady = true
-
-		case GRUNNING:
-			// only record latency if we have a READY
-			if st.hasReady && ev.Timestamp > st.lastReady {
-				latency := float64(ev.Timestamp-st.lastReady) / 1000.0
-				latencies = append(latencies, latency)
-			}
-
-			// after RUNNING, reset state
-			st.hasReady = false
-		}
+func makeSchedulingLatencyCDF(data []ChangeEvent, timeframes []Timeframe, phase string) {
+	latencies := schedulingLatencies(data, timeframes)
+	if len(latencies) == 0 {
+		log.Println("No scheduling latencies in timeframe!")
+		return
 	}
 
 	// Sort the samples (required for a CDF)
@@ -375,7 +334,7 @@ func makeSchedulingLatencyCDF(data []ChangeEvent, timeframes []Timeframe) {
 	}
 
 	p := plot.New()
-	p.Title.Text = "Scheduling Latency CDF"
+	p.Title.Text = phaseTitle("Scheduling Latency CDF", phase)
 	p.X.Label.Text = "Latency (µs)"
 	p.Y.Label.Text = "Cumulative Probability"
 
@@ -389,52 +348,22 @@ func makeSchedulingLatencyCDF(data []ChangeEvent, timeframes []Timeframe) {
 	p.Y.Min = 0
 	p.Y.Max = 1
 
-	if err := p.Save(8*vg.Inch, 5*vg.Inch, "goroutine_schduling_latency_cdf.png"); err != nil {
+	if err := p.Save(8*vg.Inch, 5*vg.Inch, phaseFile("goroutine_schduling_latency_cdf.png", phase)); err != nil {
 		log.Fatal(err)
 	}
 
 }
 
-func makeSchedulingLatencyHistogram(data []ChangeEvent, timeframes []Timeframe) {
-	states := make(map[int64]*GState)
-
-	// All collected latencies
-	var latencies []float64
-
-	for _, ev := range data {
-		if !withinTimeframe(ev.Timestamp, timeframes) {
-			continue
-		}
-
-		gid := ev.GoRoutineID
-		st, exists := states[gid]
-		if !exists {
-			st = &GState{}
-			states[gid] = st
-		}
-
-		switch gstatus(ev.NewStatus) {
-
-		case GRUNNABLE:
-			// record a new READY; discard any stale READY/RUNNING
-			st.lastReady = ev.Timestamp
-			st.hasReady = true
-
-		case GRUNNING:
-			// only record latency if we have a READY
-			if st.hasReady && ev.Timestamp > st.lastReady {
-				latency := float64(ev.Timestamp-st.lastReady) / 1000.0
-				latencies = append(latencies, latency)
-			}
-
-			// after RUNNING, reset state
-			st.hasReady = false
-		}
+func makeSchedulingLatencyHistogram(data []ChangeEvent, timeframes []Timeframe, phase string) {
+	latencies := schedulingLatencies(data, timeframes)
+	if len(latencies) == 0 {
+		log.Println("No scheduling latencies in timeframe!")
+		return
 	}
 
 	// Now produce histogram
 	p := plot.New()
-	p.Title.Text = "Scheduling Latency (PDF)"
+	p.Title.Text = phaseTitle("Scheduling Latency (PDF)", phase)
 	p.X.Label.Text = "Latency (µs)"
 	p.Y.Label.Text = "Frequency"
 
@@ -451,12 +380,12 @@ func makeSchedulingLatencyHistogram(data []ChangeEvent, timeframes []Timeframe)
 
 	p.Add(hist)
 
-	if err := p.Save(8*vg.Inch, 5*vg.Inch, "goroutine_scheduling_latency_hist.png"); err != nil {
+	if err := p.Save(8*vg.Inch, 5*vg.Inch, phaseFile("goroutine_scheduling_latency_hist.png", phase)); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func makeGoroutinesCreated(data []SchedEvent, timeframes []Timeframe) {
+func makeGoroutinesCreated(data []SchedEvent, timeframes []Timeframe, phase string) {
 
 	var pts plotter.XYs // start empty
 
@@ -475,9 +404,13 @@ func makeGoroutinesCreated(data []SchedEvent, timeframes []Timeframe) {
 			pts = append(pts, plotter.XY{X: x, Y: y})
 		}
 	}
+	if len(pts) == 0 {
+		log.Println("No goroutines created in timeframe!")
+		return
+	}
 
 	p := plot.New()
-	p.Title.Text = "Total Goroutines Created Over Time"
+	p.Title.Text = phaseTitle("Total Goroutines Created Over Time", phase)
 	p.X.Label.Text = "Time (sec)"
 	p.Y.Label.Text = "Goroutines Created"
 
@@ -487,13 +420,13 @@ func makeGoroutinesCreated(data []SchedEvent, timeframes []Timeframe) {
 	}
 	p.Add(line)
 
-	if err := p.Save(10*vg.Inch, 4*vg.Inch, "goroutines_created.png"); err != nil {
+	if err := p.Save(10*vg.Inch, 4*vg.Inch, phaseFile("goroutines_created.png", phase)); err != nil {
 		log.Fatal(err)
 	}
 }
 
 // shows runtime noise and scheduling spikes
-func makeCycleScatterPlot(data []CycleEvent, timeframes []Timeframe) {
+func makeCycleScatterPlot(data []CycleEvent, timeframes []Timeframe, phase string) {
 	// pts := make(plotter.XYs, len(events))
 	var pts plotter.XYs // start empty
 	// counter := 0
@@ -506,21 +439,25 @@ func makeCycleScatterPlot(data []CycleEvent, timeframes []Timeframe) {
 		y := float64(e.Cycles)
 		pts = append(pts, plotter.XY{X: x, Y: y})
 	}
+	if len(pts) == 0 {
+		log.Println("No CycleEvent entries in timeframe!")
+		return
+	}
 
 	p := plot.New()
-	p.Title.Text = "Cycles per Goroutine Creation Over Time"
+	p.Title.Text = phaseTitle("Cycles per Goroutine Creation Over Time", phase)
 	p.X.Label.Text = "Time (s)"
 	p.Y.Label.Text = "Cycles"
 
 	line, _ := plotter.NewLine(pts) // or NewScatter
 	p.Add(line)
 
-	if err := p.Save(10*vg.Inch, 4*vg.Inch, "creation_cycles_scatter.png"); err != nil {
+	if err := p.Save(10*vg.Inch, 4*vg.Inch, phaseFile("creation_cycles_scatter.png", phase)); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func makeCyclesHistogram(data []CycleEvent, timeframes []Timeframe) {
+func makeCyclesHistogram(data []CycleEvent, timeframes []Timeframe, phase string) {
 	// var pts plotter.XYs // start empty
 	vals := plotter.Values{}
 	var maxCycles float64
@@ -534,24 +471,28 @@ func makeCyclesHistogram(data []CycleEvent, timeframes []Timeframe) {
 		}
 		vals = append(vals, float64(e.Cycles))
 	}
+	if len(vals) == 0 {
+		log.Println("No CycleEvent entries in timeframe!")
+		return
+	}
 
 	binWidth := 2500.0
 	numBins := int(maxCycles/binWidth) + 1
 
 	p := plot.New()
-	p.Title.Text = "Histogram of Cycles per Goroutine Creation"
+	p.Title.Text = phaseTitle("Histogram of Cycles per Goroutine Creation", phase)
 	p.X.Label.Text = "Cycles"
 	p.Y.Label.Text = "Count"
 
 	h, _ := plotter.NewHist(vals, numBins)
 	p.Add(h)
 
-	if err := p.Save(10*vg.Inch, 4*vg.Inch, "creation_cycles_hist.png"); err != nil {
+	if err := p.Save(10*vg.Inch, 4*vg.Inch, phaseFile("creation_cycles_hist.png", phase)); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func makeCyclesCDF(data []CycleEvent, timeframes []Timeframe) {
+func makeCyclesCDF(data []CycleEvent, timeframes []Timeframe, phase string) {
 	// Filter data first
 	filtered := make([]CycleEvent, 0, len(data))
 	for _, e := range data {
@@ -581,7 +522,7 @@ func makeCyclesCDF(data []CycleEvent, timeframes []Timeframe) {
 
 	// Plot
 	p := plot.New()
-	p.Title.Text = "CDF: Cycles per Goroutine Creation"
+	p.Title.Text = phaseTitle("CDF: Cycles per Goroutine Creation", phase)
 	p.X.Label.Text = "Cycles"
 	p.Y.Label.Text = "Percentile"
 
@@ -592,53 +533,40 @@ func makeCyclesCDF(data []CycleEvent, timeframes []Timeframe) {
 	p.Add(l)
 
 	// Save
-	if err := p.Save(10*vg.Inch, 4*vg.Inch, "creation_cycles_cdf.png"); err != nil {
+	if err := p.Save(10*vg.Inch, 4*vg.Inch, phaseFile("creation_cycles_cdf.png", phase)); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func getSummaryData(filePath string) ([]Summary, error) {
-	var data []Summary
-	check := checkFile(filePath)
-	if check != nil {
-		return nil, fmt.Errorf("the File was invalid type, needs to be: .jsonl")
-	}
-
-	f, err := os.Open(filePath)
+// appendJSONL appends each of vs to path as one line of JSON, creating the file if needed
+func appendJSONL(path string, vs ...any) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		// log.Fatalf("failed to open file %s: %v", filePath, err)
-		return nil, fmt.Errorf("failed to Open file")
+		return err
 	}
 	defer f.Close()
 
-	scanner := bufio.NewScanner(f)
-
-	// Read file line by line
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
-		}
-		var s Summary
-		if err := json.Unmarshal(line, &s); err != nil {
-			log.Printf("Skipping invalid line: %v", err)
-			continue
+	enc := json.NewEncoder(f)
+	for _, v := range vs {
+		err = enc.Encode(v)
+		if err != nil {
+			return err
 		}
-		data = append(data, s)
-	}
-	if err := scanner.Err(); err != nil {
-		log.Fatalf("error reading file: %v", err)
-	}
-
-	if len(data) == 0 {
-		log.Fatal("No valid records found in results.jsonl")
 	}
+	return f.Close()
+}
 
-	return data, nil
+// resultSibling is the file written next to a result file, result.jsonl gets result_<suffix>.jsonl
+func resultSibling(resultFile string, suffix string) string {
+	return strings.TrimSuffix(resultFile, ".jsonl") + "_" + suffix + ".jsonl"
 }
 
-func getGStatusData(filePath string) ([]ChangeEvent, error) {
-	var data []ChangeEvent
+// longest line readJSONL accepts
+const maxJSONLLine = 64 << 20
+
+// readJSONL reads every record of a .jsonl file, skipping blank and invalid lines
+func readJSONL[T any](filePath string) ([]T, error) {
+	var data []T
 	check := checkFile(filePath)
 	if check != nil {
 		return nil, fmt.Errorf("the File was invalid type, needs to be: .jsonl")
@@ -646,12 +574,13 @@ func getGStatusData(filePath string) ([]ChangeEvent, error) {
 
 	f, err := os.Open(filePath)
 	if err != nil {
-		// log.Fatalf("failed to open file %s: %v", filePath, err)
-		return nil, fmt.Errorf("failed to Open file")
+		return nil, fmt.Errorf("failed to Open file %s: %v", filePath, err)
 	}
 	defer f.Close()
 
 	scanner := bufio.NewScanner(f)
+	// a summary carries its latency histograms, far past the scanner's default 64KB line
+	scanner.Buffer(make([]byte, 0, 64*1024), maxJSONLLine)
 
 	// Read file line by line
 	for scanner.Scan() {
@@ -659,7 +588,7 @@ func getGStatusData(filePath string) ([]ChangeEvent, error) {
 		if len(line) == 0 {
 			continue
 		}
-		var s ChangeEvent
+		var s T
 		if err := json.Unmarshal(line, &s); err != nil {
 			log.Printf("Skipping invalid line: %v", err)
 			continue
@@ -667,187 +596,433 @@ func getGStatusData(filePath string) ([]ChangeEvent, error) {
 		data = append(data, s)
 	}
 	if err := scanner.Err(); err != nil {
-		log.Fatalf("error reading file: %v", err)
+		log.Fatalf("error reading file %s: %v", filePath, err)
 	}
 
 	if len(data) == 0 {
-		log.Fatal("No valid records found in results.jsonl")
+		log.Fatalf("No valid records found in %s", filePath)
 	}
 
 	return data, nil
 }
 
+func getSummaryData(filePath string) ([]Summary, error) {
+	return readJSONL[Summary](filePath)
+}
+
+func getGStatusData(filePath string) ([]ChangeEvent, error) {
+	return readJSONL[ChangeEvent](filePath)
+}
+
 func getGQueueData(filePath string) ([]GQueueTimestamp, error) {
-	var data []GQueueTimestamp
-	check := checkFile(filePath)
-	if check != nil {
-		return nil, fmt.Errorf("the File was invalid type, needs to be: .jsonl")
-	}
+	return readJSONL[GQueueTimestamp](filePath)
+}
 
-	f, err := os.Open(filePath)
-	if err != nil {
-		// log.Fatalf("failed to open file %s: %v", filePath, err)
-		return nil, fmt.Errorf("failed to Open file")
-	}
-	defer f.Close()
+func getInstrumentationData(filePath string) ([]SchedEvent, error) {
+	return readJSONL[SchedEvent](filePath)
+}
 
-	scanner := bufio.NewScanner(f)
+func getCyclesData(filePath string) ([]CycleEvent, error) {
+	return readJSONL[CycleEvent](filePath)
+}
 
-	// Read file line by line
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
+func getRuntimeMetricsData(filePath string) ([]RuntimeMetricsSample, error) {
+	return readJSONL[RuntimeMetricsSample](filePath)
+}
+
+func getRateSampleData(filePath string) ([]RateSample, error) {
+	return readJSONL[RateSample](filePath)
+}
+
+func getTimeframeData(filePath string) ([]Timeframe, error) {
+	return readJSONL[Timeframe](filePath)
+}
+
+// where experiment artifacts such as timeframe.jsonl are read from, set with the leading -out and -run options
+var outputRoot = "../json_results"
+var runID = ""
+
+// outputPath returns <out>/<run-id>/name
+func outputPath(name string) string {
+	return filepath.Join(outputRoot, runID, name)
+}
+
+// creationLatencies returns the time in µs between each goroutine being created and first executed
+func creationLatencies(data []SchedEvent, timeframes []Timeframe) []float64 {
+	creation := make(map[int64]int64)
+	firstExec := make(map[int64]int64)
+	for i := 0; i < len(data); i++ {
+		ev := data[i]
+		if !withinTimeframe(ev.Timestamp, timeframes) {
 			continue
 		}
-		var s GQueueTimestamp
-		if err := json.Unmarshal(line, &s); err != nil {
-			log.Printf("Skipping invalid line: %v", err)
-			continue
+		switch ev.ActionID {
+		case GOROUTINE_CREATION:
+			if _, exists := creation[ev.GoRoutineID]; !exists {
+				creation[ev.GoRoutineID] = ev.Timestamp
+			}
+		case GOROUTINE_EXECUTION:
+			if _, exists := firstExec[ev.GoRoutineID]; !exists {
+				firstExec[ev.GoRoutineID] = ev.Timestamp
+			}
 		}
-		data = append(data, s)
-	}
-	if err := scanner.Err(); err != nil {
-		log.Fatalf("error reading file: %v", err)
-	}
 
-	if len(data) == 0 {
-		log.Fatal("No valid records found in results.jsonl")
 	}
 
-	return data, nil
+	// Compute latencies
+	latencies := []float64{}
+	for gid, c := range creation {
+		if s, ok := firstExec[gid]; ok && s > c {
+			// convert ns --> microseconds
+			latency := float64(s-c) / 1000.0
+			latencies = append(latencies, latency)
+		}
+	}
+	return latencies
 }
 
-func getInstrumentationData(filePath string) ([]SchedEvent, error) {
-	var data []SchedEvent
-	check := checkFile(filePath)
-	if check != nil {
-		return nil, fmt.Errorf("the File was invalid type, needs to be: .jsonl")
-	}
+// schedulingLatencies returns the time in µs each goroutine spent runnable before it was running
+func schedulingLatencies(data []ChangeEvent, timeframes []Timeframe) []float64 {
+	states := make(map[int64]*GState)
 
-	f, err := os.Open(filePath)
-	if err != nil {
-		// log.Fatalf("failed to open file %s: %v", filePath, err)
-		return nil, fmt.Errorf("failed to Open file")
+	// All collected latencies
+	var latencies []float64
+
+	for _, ev := range data {
+		if !withinTimeframe(ev.Timestamp, timeframes) {
+			continue
+		}
+
+		gid := ev.GoRoutineID
+		st, exists := states[gid]
+		if !exists {
+			st = &GState{}
+			states[gid] = st
+		}
+
+		switch gstatus(ev.NewStatus) {
+
+		case GRUNNABLE:
+			// record a new READY; discard any stale READY/RUNNING
+			st.lastReady = ev.Timestamp
+			st.hasReady = true
+
+		case GRUNNING:
+			// only record latency if we have a READY
+			if st.hasReady && ev.Timestamp > st.lastReady {
+				latency := float64(ev.Timestamp-st.lastReady) / 1000.0
+				latencies = append(latencies, latency)
+			}
+
+			// after RUNNING, reset state
+			st.hasReady = false
+		}
 	}
-	defer f.Close()
+	return latencies
+}
 
-	scanner := bufio.NewScanner(f)
+/*
 
-	// Read file line by line
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
+	runtime/metrics graphs, to cross-check the instrumentation against the official runtime numbers
+
+*/
+
+// runtimeMetricsLine plots one value of every sample inside the timeframes against seconds since the first timeframe
+func runtimeMetricsLine(data []RuntimeMetricsSample, timeframes []Timeframe, value func(RuntimeMetricsSample) (float64, bool)) plotter.XYs {
+	var pts plotter.XYs
+	startTime := timeframes[0].Start
+	for _, s := range data {
+		if !withinTimeframe(s.Timestamp, timeframes) {
 			continue
 		}
-		var s SchedEvent
-		if err := json.Unmarshal(line, &s); err != nil {
-			log.Printf("Skipping invalid line: %v", err)
+		y, ok := value(s)
+		if !ok {
 			continue
 		}
-		data = append(data, s)
+		x := float64(time.Duration(s.Timestamp - startTime).Seconds())
+		pts = append(pts, plotter.XY{X: x, Y: y})
 	}
-	if err := scanner.Err(); err != nil {
-		log.Fatalf("error reading file: %v", err)
+	return pts
+}
+
+// saveRuntimeMetricsPlot draws each named line on one graph, lines without points are left out
+func saveRuntimeMetricsPlot(title string, yLabel string, file string, names []string, lines []plotter.XYs) {
+	colors := []color.Color{
+		color.RGBA{255, 99, 132, 255},  // red
+		color.RGBA{54, 162, 235, 255},  // blue
+		color.RGBA{75, 192, 192, 255},  // teal
+		color.RGBA{255, 206, 86, 255},  // yellow
+		color.RGBA{153, 102, 255, 255}, // purple
+		color.RGBA{255, 159, 64, 255},  // orange
 	}
 
-	if len(data) == 0 {
-		log.Fatal("No valid records found in results.jsonl")
+	p := plot.New()
+	p.Title.Text = title
+	p.X.Label.Text = "Time (sec)"
+	p.Y.Label.Text = yLabel
+	p.Add(plotter.NewGrid())
+
+	plotted := 0
+	for i, pts := range lines {
+		if len(pts) == 0 {
+			continue
+		}
+		line, err := plotter.NewLine(pts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		line.Color = colors[i%len(colors)]
+		p.Add(line)
+		p.Legend.Add(names[i], line)
+		plotted++
+	}
+	if plotted == 0 {
+		log.Printf("No samples to plot for %s!\n", file)
+		return
 	}
+	p.Legend.Top = true
+	p.Legend.Left = true
 
-	return data, nil
+	if err := p.Save(10*vg.Inch, 4*vg.Inch, file); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Saved:", file)
 }
 
-func getCyclesData(filePath string) ([]CycleEvent, error) {
-	var data []CycleEvent
-	check := checkFile(filePath)
-	if check != nil {
-		return nil, fmt.Errorf("the File was invalid type, needs to be: .jsonl")
+// makeRateProfileGraphs draws the target, offered and achieved rate of every load test in the rates file,
+// a new test starts whenever the seconds go back to 0
+func makeRateProfileGraphs(data []RateSample) {
+	var runs [][]RateSample
+	for _, s := range data {
+		if s.Second == 0 || len(runs) == 0 {
+			runs = append(runs, nil)
+		}
+		runs[len(runs)-1] = append(runs[len(runs)-1], s)
+	}
+
+	for i, run := range runs {
+		target := make(plotter.XYs, 0, len(run))
+		offered := make(plotter.XYs, len(run))
+		achieved := make(plotter.XYs, len(run))
+		for j, s := range run {
+			// the middle of the second, where the target was taken
+			x := float64(s.Second) + 0.5
+			if s.Target > 0 {
+				target = append(target, plotter.XY{X: x, Y: s.Target})
+			}
+			offered[j] = plotter.XY{X: x, Y: float64(s.Offered)}
+			achieved[j] = plotter.XY{X: x, Y: float64(s.Achieved)}
+		}
+
+		title := fmt.Sprintf("Offered vs Achieved Rate, %s %s (seed %d)", run[0].Operation, run[0].Profile, run[0].Seed)
+		saveRuntimeMetricsPlot(title, "Requests/sec", fmt.Sprintf("rate_profile_%d.png", i+1),
+			[]string{"target", "offered", "achieved"}, []plotter.XYs{target, offered, achieved})
 	}
+}
 
-	f, err := os.Open(filePath)
-	if err != nil {
-		// log.Fatalf("failed to open file %s: %v", filePath, err)
-		return nil, fmt.Errorf("failed to Open file")
+func makeRuntimeMetricsGraphs(data []RuntimeMetricsSample, timeframes []Timeframe) {
+	gc := func(name string, scale float64) func(RuntimeMetricsSample) (float64, bool) {
+		return func(s RuntimeMetricsSample) (float64, bool) {
+			v, ok := s.GC[name]
+			return v / scale, ok
+		}
 	}
-	defer f.Close()
 
-	scanner := bufio.NewScanner(f)
+	goroutines := runtimeMetricsLine(data, timeframes, func(s RuntimeMetricsSample) (float64, bool) {
+		return float64(s.Goroutines), true
+	})
+	saveRuntimeMetricsPlot("Goroutines (runtime/metrics)", "Goroutines", "runtime_goroutines.png",
+		[]string{"/sched/goroutines"}, []plotter.XYs{goroutines})
 
-	// Read file line by line
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
+	// samples where nothing was scheduled have no latency to show
+	schedLatency := func(pct func(RuntimeMetricsSample) float64) func(RuntimeMetricsSample) (float64, bool) {
+		return func(s RuntimeMetricsSample) (float64, bool) {
+			return pct(s) * 1e6, s.SchedLatencyCount > 0 // seconds --> microseconds
 		}
-		var c CycleEvent
-		if err := json.Unmarshal(line, &c); err != nil {
-			log.Printf("Skipping invalid line: %v", err)
-			continue
-		}
-		data = append(data, c)
 	}
-	if err := scanner.Err(); err != nil {
-		log.Fatalf("error reading file: %v", err)
+	saveRuntimeMetricsPlot("Scheduling Latency (runtime/metrics)", "Latency (µs)", "runtime_sched_latency.png",
+		[]string{"P50", "P95", "P99"},
+		[]plotter.XYs{
+			runtimeMetricsLine(data, timeframes, schedLatency(func(s RuntimeMetricsSample) float64 { return s.SchedLatencyP50 })),
+			runtimeMetricsLine(data, timeframes, schedLatency(func(s RuntimeMetricsSample) float64 { return s.SchedLatencyP95 })),
+			runtimeMetricsLine(data, timeframes, schedLatency(func(s RuntimeMetricsSample) float64 { return s.SchedLatencyP99 })),
+		})
+
+	saveRuntimeMetricsPlot("GC Cycles (runtime/metrics)", "GC Cycles", "runtime_gc_cycles.png",
+		[]string{"total", "automatic", "forced"},
+		[]plotter.XYs{
+			runtimeMetricsLine(data, timeframes, gc("/gc/cycles/total:gc-cycles", 1)),
+			runtimeMetricsLine(data, timeframes, gc("/gc/cycles/automatic:gc-cycles", 1)),
+			runtimeMetricsLine(data, timeframes, gc("/gc/cycles/forced:gc-cycles", 1)),
+		})
+
+	saveRuntimeMetricsPlot("GC Heap (runtime/metrics)", "Heap (MB)", "runtime_gc_heap.png",
+		[]string{"goal", "live"},
+		[]plotter.XYs{
+			runtimeMetricsLine(data, timeframes, gc("/gc/heap/goal:bytes", 1<<20)),
+			runtimeMetricsLine(data, timeframes, gc("/gc/heap/live:bytes", 1<<20)),
+		})
+
+	// sanity check against the instrumentation: how many goroutines the runtime saw being scheduled
+	var scheduled uint64
+	for _, s := range data {
+		if withinTimeframe(s.Timestamp, timeframes) {
+			scheduled += s.SchedLatencyCount
+		}
 	}
+	fmt.Printf("Goroutines scheduled in timeframe according to runtime/metrics: %d\n", scheduled)
+}
 
-	if len(data) == 0 {
-		log.Fatal("No valid records found in results.jsonl")
-	}
+/*
 
-	return data, nil
+	Phases, timeframes that share a label are analyzed together
+
+*/
+
+// phases groups the timeframes by label, labels are returned in the order they first appear
+func phases(timeframes []Timeframe) ([]string, map[string][]Timeframe) {
+	var labels []string
+	grouped := make(map[string][]Timeframe)
+	for _, tf := range timeframes {
+		label := tf.Label
+		if label == "" {
+			label = "unlabeled"
+		}
+		if _, seen := grouped[label]; !seen {
+			labels = append(labels, label)
+		}
+		grouped[label] = append(grouped[label], tf)
+	}
+	return labels, grouped
 }
 
-func getTimeframeData(filePath string) ([]Timeframe, error) {
-	var data []Timeframe
-	check := checkFile(filePath)
-	if check != nil {
-		return nil, fmt.Errorf("the File was invalid type, needs to be: .jsonl")
+// phaseFile adds the phase to a graph file name, goroutines_created.png -> goroutines_created_steady.png.
+// The combined view (phase "") keeps the original name.
+func phaseFile(file string, phase string) string {
+	if phase == "" {
+		return file
 	}
+	safe := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, phase)
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "_" + safe + ext
+}
 
-	f, err := os.Open(filePath)
-	if err != nil {
-		// log.Fatalf("failed to open file %s: %v", filePath, err)
-		return nil, fmt.Errorf("failed to Open file")
+func phaseTitle(title string, phase string) string {
+	if phase == "" {
+		return title
 	}
-	defer f.Close()
+	return fmt.Sprintf("%s [%s]", title, phase)
+}
 
-	scanner := bufio.NewScanner(f)
+// printPhaseCounts prints how many events and samples each phase had along with sample percentiles
+func printPhaseCounts(name string, unit string, labels []string, events map[string]int, samples map[string][]float64) {
+	fmt.Printf("\n%s by Phase:\n", name)
+	fmt.Printf("Phase\t\tEvents\tSamples\tP50(%s)\tP95(%s)\tP99(%s)\n", unit, unit, unit)
+	fmt.Println("-------------------------------------------------------------------------")
+	for _, label := range labels {
+		vals := samples[label]
+		sort.Float64s(vals)
+		fmt.Printf("%-12s\t%d\t%d\t%.2f\t%.2f\t%.2f\n", label, events[label], len(vals),
+			selectPercentile(vals, 0.50), selectPercentile(vals, 0.95), selectPercentile(vals, 0.99))
+	}
+}
 
-	// Read file line by line
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
-		}
-		var s Timeframe
-		if err := json.Unmarshal(line, &s); err != nil {
-			log.Printf("Skipping invalid line: %v", err)
-			continue
+// countWithin counts the timestamps that fall inside the timeframes
+func countWithin(timestamps []int64, timeframes []Timeframe) int {
+	count := 0
+	for _, ts := range timestamps {
+		if withinTimeframe(ts, timeframes) {
+			count++
 		}
-		data = append(data, s)
 	}
-	if err := scanner.Err(); err != nil {
-		log.Fatalf("error reading file: %v", err)
+	return count
+}
+
+// analyzeInstrumentation makes the -inst graphs for all timeframes combined and then for each phase
+func analyzeInstrumentation(data []SchedEvent, timeframes []Timeframe) {
+	makeCreationLatencyHistogram(data, timeframes, "")
+	makeCreationLatencyCDF(data, timeframes, "")
+	makeGoroutinesCreated(data, timeframes, "")
+
+	timestamps := make([]int64, len(data))
+	for i, e := range data {
+		timestamps[i] = e.Timestamp
+	}
+
+	labels, grouped := phases(timeframes)
+	events := map[string]int{"combined": countWithin(timestamps, timeframes)}
+	samples := map[string][]float64{"combined": creationLatencies(data, timeframes)}
+	for _, label := range labels {
+		if len(labels) > 1 {
+			makeCreationLatencyHistogram(data, grouped[label], label)
+			makeCreationLatencyCDF(data, grouped[label], label)
+			makeGoroutinesCreated(data, grouped[label], label)
+		}
+		events[label] = countWithin(timestamps, grouped[label])
+		samples[label] = creationLatencies(data, grouped[label])
 	}
+	printPhaseCounts("Goroutine Creation Latency", "µs", append(labels, "combined"), events, samples)
+}
 
-	if len(data) == 0 {
-		log.Fatal("No valid records found in results.jsonl")
+// analyzeGStatus makes the -gstat graphs for all timeframes combined and then for each phase
+func analyzeGStatus(data []ChangeEvent, timeframes []Timeframe) {
+	makeSchedulingLatencyCDF(data, timeframes, "")
+	makeSchedulingLatencyHistogram(data, timeframes, "")
+
+	timestamps := make([]int64, len(data))
+	for i, e := range data {
+		timestamps[i] = e.Timestamp
 	}
 
-	return data, nil
+	labels, grouped := phases(timeframes)
+	events := map[string]int{"combined": countWithin(timestamps, timeframes)}
+	samples := map[string][]float64{"combined": schedulingLatencies(data, timeframes)}
+	for _, label := range labels {
+		if len(labels) > 1 {
+			makeSchedulingLatencyCDF(data, grouped[label], label)
+			makeSchedulingLatencyHistogram(data, grouped[label], label)
+		}
+		events[label] = countWithin(timestamps, grouped[label])
+		samples[label] = schedulingLatencies(data, grouped[label])
+	}
+	printPhaseCounts("Scheduling Latency", "µs", append(labels, "combined"), events, samples)
 }
 
-func logTimeframe(tf Timeframe) {
-	f, err := os.OpenFile("../json_results/timeframe.jsonl", os.O_CREATE|os.O_WRONLY, 0644) // 0644 gives read and write permisisons
-	if err != nil {
-		log.Println("Unable to open file to write summary record")
-		log.Fatal(err)
-	}
-	err = json.NewEncoder(f).Encode(tf)
-	if err != nil {
-		log.Println("Summary contained NaN due to low performance, cannot write this record")
+// analyzeCycles makes the -cycle graphs for all timeframes combined and then for each phase
+func analyzeCycles(data []CycleEvent, timeframes []Timeframe) {
+	makeCycleScatterPlot(data, timeframes, "")
+	makeCyclesHistogram(data, timeframes, "")
+	makeCyclesCDF(data, timeframes, "")
+
+	cycles := func(tfs []Timeframe) []float64 {
+		var vals []float64
+		for _, e := range data {
+			if withinTimeframe(e.Timestamp, tfs) {
+				vals = append(vals, float64(e.Cycles))
+			}
+		}
+		return vals
+	}
+
+	labels, grouped := phases(timeframes)
+	events := make(map[string]int)
+	samples := map[string][]float64{"combined": cycles(timeframes)}
+	events["combined"] = len(samples["combined"])
+	for _, label := range labels {
+		if len(labels) > 1 {
+			makeCycleScatterPlot(data, grouped[label], label)
+			makeCyclesHistogram(data, grouped[label], label)
+			makeCyclesCDF(data, grouped[label], label)
+		}
+		samples[label] = cycles(grouped[label])
+		events[label] = len(samples[label])
 	}
-	f.Close()
+	printPhaseCounts("Cycles per Goroutine Creation", "cyc", append(labels, "combined"), events, samples)
 }
 
 // Is timestamp within any timeframe?
@@ -860,7 +1035,89 @@ func withinTimeframe(ts int64, timeframes []Timeframe) bool {
 	return false
 }
 
-func makeGraphs(data []Summary) {
+// ninesTicks labels an axis of -log10(1 - quantile), 1 is 90%, 2 is 99%, 3 is 99.9%
+func ninesTicks(min, max float64) []plot.Tick {
+	var ticks []plot.Tick
+	for n := math.Floor(min); n <= max; n++ {
+		label := "0%"
+		if n > 0 {
+			label = strconv.FormatFloat(100*(1-math.Pow(10, -n)), 'f', -1, 64) + "%"
+		}
+		ticks = append(ticks, plot.Tick{Value: n, Label: label})
+	}
+	return ticks
+}
+
+// makePercentileSpectra plots latency against percentile up to the slowest request for each operation,
+// histograms of summaries at the same rate (other seeds or repetitions) are merged into one line
+func makePercentileSpectra(grouped map[string][]Summary, colors []color.Color) {
+	dashes := [][]vg.Length{nil, {vg.Points(4), vg.Points(2)}, {vg.Points(1), vg.Points(2)}}
+	for _, op := range operations(grouped) {
+		merged := make(map[int]*Histogram)
+		var rates []int
+		for _, s := range grouped[op] {
+			if s.LatencyHist == nil || s.LatencyHist.count() == 0 {
+				continue
+			}
+			if merged[s.Rate] == nil {
+				merged[s.Rate] = newHistogram()
+				rates = append(rates, s.Rate)
+			}
+			merged[s.Rate].merge(s.LatencyHist)
+		}
+		if len(rates) == 0 {
+			// result files written before the histograms were recorded
+			continue
+		}
+		sort.Ints(rates)
+
+		p := plot.New()
+		p.Title.Text = fmt.Sprintf("Latency by Percentile, %s", op)
+		p.X.Label.Text = "Percentile"
+		p.Y.Label.Text = "Latency (ms)"
+		p.X.Tick.Marker = plot.TickerFunc(ninesTicks)
+		p.Add(plotter.NewGrid())
+
+		for i, rate := range rates {
+			h := merged[rate]
+			// the last point is the slowest request, 1 - 1/count of the way along
+			end := math.Log10(float64(h.count()))
+			var points plotter.XYs
+			for x := 0.0; x < end; x += 0.02 {
+				points = append(points, plotter.XY{X: x, Y: h.quantileMs(1 - math.Pow(10, -x))})
+			}
+			points = append(points, plotter.XY{X: end, Y: h.quantileMs(1)})
+
+			line, _ := plotter.NewLine(points)
+			line.Color = colors[i%len(colors)]
+			line.Dashes = dashes[(i/len(colors))%len(dashes)]
+			p.Add(line)
+			p.Legend.Add(fmt.Sprintf("%d req/s", rate), line)
+		}
+		p.Legend.Top = true
+		p.Legend.Left = true
+
+		file := phaseFile("percentile_spectrum.png", op)
+		if err := p.Save(9*vg.Inch, 5*vg.Inch, file); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Saved:", file)
+	}
+}
+
+// operations returns the grouped operations in name order, so the per operation lines of a mixed test
+// follow its aggregate and every operation keeps its color between runs
+func operations(grouped map[string][]Summary) []string {
+	ops := make([]string, 0, len(grouped))
+	for op := range grouped {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	return ops
+}
+
+// makeGraphs draws the load test graphs, the capacity of each operation in knees is circled (-knee)
+func makeGraphs(data []Summary, knees map[string]Knee) {
 	// Group by operation
 	grouped := make(map[string][]Summary)
 	for _, s := range data {
@@ -881,12 +1138,39 @@ func makeGraphs(data []Summary) {
 		color.RGBA{255, 159, 64, 255},  // orange
 	}
 
-	makeAvgLoadLatency(grouped, colors)
-	makeP95LoadLatency(grouped, colors)
-	makeP99LoadLatency(grouped, colors)
-	makeP50LoadLatency(grouped, colors)
+	makeAvgLoadLatency(grouped, colors, knees)
+	makeP95LoadLatency(grouped, colors, knees)
+	makeP99LoadLatency(grouped, colors, knees)
+	makeP50LoadLatency(grouped, colors, knees)
 
-	makeThrouputAnalysis(grouped, colors)
+	makeThrouputAnalysis(grouped, colors, knees)
+	makePercentileSpectra(grouped, colors)
+}
+
+// errorCounts lists the failures of a summary by class and then by operation,
+// e.g. "timeout=12 rpc=1 | hash: timeout=12 | sort: rpc=1"
+func errorCounts(s Summary) string {
+	classCounts := func(counts map[string]int) string {
+		var parts []string
+		for _, class := range errorClasses {
+			if counts[class] > 0 {
+				parts = append(parts, fmt.Sprintf("%s=%d", class, counts[class]))
+			}
+		}
+		return strings.Join(parts, " ")
+	}
+
+	if len(s.ErrorClasses) == 0 {
+		// result files written before errors were classified
+		return strconv.Itoa(s.Errors)
+	}
+	out := classCounts(s.ErrorClasses)
+	for _, op := range []string{OpHash, OpMatMul, OpZlib, OpSort} {
+		if len(s.OpErrors[op]) > 0 {
+			out += fmt.Sprintf(" | %s: %s", op, classCounts(s.OpErrors[op]))
+		}
+	}
+	return out
 }
 
 func printSummary(data []Summary) {
@@ -903,13 +1187,21 @@ func printSummary(data []Summary) {
 
 	// Print summary per operation
 	fmt.Println("\n Summary by Operation:")
-	for op, list := range grouped {
+	for _, op := range operations(grouped) {
+		list := grouped[op]
 		fmt.Printf("\nOperation: %s\n", op)
-		fmt.Println("Seed\tRate\tAvg(ms)\tP50(ms)\tP95(ms)\tP99(ms)\tThroughput\tErrors")
-		fmt.Println("-------------------------------------------------------------------------")
+		fmt.Println("Seed\tRate\tAvg(ms)\tP50(ms)\tP95(ms)\tP99(ms)\tP99.9(ms)\tP99.99(ms)\tThroughput\tErrors\tcP50(ms)\tcP95(ms)\tcP99(ms)")
+		fmt.Println("---------------------------------------------------------------------------------------------------------------------------------")
 		for _, s := range list {
-			fmt.Printf("%d\t%d\t%.2f\t%.2f\t%.2f\t%.2f\t%.1f\t\t%d\n",
-				s.Seed, s.Rate, s.AvgLatency, s.P50Latency, s.P95Latency, s.P99Latency, s.Throughput, s.Errors)
+			fmt.Printf("%d\t%d\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t\t%.2f\t\t%.1f\t\t%d\t%.2f\t\t%.2f\t\t%.2f\n",
+				s.Seed, s.Rate, s.AvgLatency, s.P50Latency, s.P95Latency, s.P99Latency, s.P999Latency, s.P9999Latency, s.Throughput, s.Errors,
+				s.CorrectedP50, s.CorrectedP95, s.CorrectedP99)
+			if s.Sizes != "" {
+				fmt.Printf("\tsizes: %s, mean %.1f\n", s.Sizes, s.MeanSize)
+			}
+			if s.Errors > 0 {
+				fmt.Printf("\terrors: %s\n", errorCounts(s))
+			}
 		}
 	}
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+
+	Arrival processes, the gaps between requests in a load test. Every process averages the rate it is given,
+	cfg.Rate or the rate profile at that point of the test.
+
+*/
+
+type ArrivalProcess string
+
+const (
+	ArrivalFixed     ArrivalProcess = "fixed"     // evenly spaced requests, the original behavior
+	ArrivalPoisson   ArrivalProcess = "poisson"   // exponential gaps
+	ArrivalPareto    ArrivalProcess = "pareto"    // heavy tailed gaps, shape is alpha and must be above 1
+	ArrivalLognormal ArrivalProcess = "lognormal" // heavy tailed gaps, shape is sigma of the underlying normal
+)
+
+// shapes used when LoadConfig.ArrivalShape is left at 0
+const (
+	defaultParetoAlpha    = 1.5
+	defaultLognormalSigma = 1.0
+)
+
+// the arrival schedule gets its own random stream so it does not shift the operation mix picked from cfg.Seed
+const arrivalSeedOffset = 0x5eed
+
+type arrivals struct {
+	process ArrivalProcess
+	shape   float64
+	randGen *rand.Rand
+}
+
+func newArrivals(cfg LoadConfig) (*arrivals, error) {
+	a := &arrivals{
+		process: cfg.Arrival,
+		shape:   cfg.ArrivalShape,
+		randGen: rand.New(rand.NewSource(cfg.Seed + arrivalSeedOffset)),
+	}
+
+	if cfg.Profile.Shape != "" {
+		err := cfg.Profile.validate()
+		if err != nil {
+			return nil, err
+		}
+	} else if cfg.Rate <= 0 {
+		return nil, fmt.Errorf("the rate must be positive, got %d", cfg.Rate)
+	}
+
+	switch a.process {
+	case "", ArrivalFixed:
+		a.process = ArrivalFixed
+	case ArrivalPoisson:
+	case ArrivalPareto:
+		if a.shape == 0 {
+			a.shape = defaultParetoAlpha
+		}
+		if a.shape <= 1 {
+			return nil, fmt.Errorf("pareto needs an alpha above 1 for the mean rate to exist, got %v", a.shape)
+		}
+	case ArrivalLognormal:
+		if a.shape == 0 {
+			a.shape = defaultLognormalSigma
+		}
+		if a.shape <= 0 {
+			return nil, fmt.Errorf("lognormal needs a positive sigma, got %v", a.shape)
+		}
+	default:
+		return nil, fmt.Errorf("unknown arrival process %q", a.process)
+	}
+	return a, nil
+}
+
+// next returns the gap between the previous request and the next one at rate requests per second
+func (a *arrivals) next(rate float64) time.Duration {
+	mean := float64(time.Second) / rate // mean gap in nanoseconds
+	switch a.process {
+	case ArrivalPoisson:
+		return time.Duration(a.randGen.ExpFloat64() * mean)
+	case ArrivalPareto:
+		// scale chosen so the mean is xm * alpha / (alpha - 1)
+		xm := mean * (a.shape - 1) / a.shape
+		return time.Duration(xm / math.Pow(1-a.randGen.Float64(), 1/a.shape))
+	case ArrivalLognormal:
+		// mu chosen so the mean is exp(mu + sigma^2 / 2)
+		mu := math.Log(mean) - a.shape*a.shape/2
+		return time.Duration(math.Exp(mu + a.shape*a.randGen.NormFloat64()))
+	default:
+		return time.Duration(mean)
+	}
+}
+
+// label is how the process is recorded in the Summary, e.g. poisson or pareto:1.5
+func (a *arrivals) label() string {
+	switch a.process {
+	case ArrivalPareto, ArrivalLognormal:
+		return fmt.Sprintf("%s:%v", a.process, a.shape)
+	}
+	return string(a.process)
+}
+
+// parseArrival reads "fixed", "poisson", "pareto[:alpha]" or "lognormal[:sigma]"
+func parseArrival(s string) (ArrivalProcess, float64, error) {
+	name, shape, hasShape := strings.Cut(s, ":")
+	switch ArrivalProcess(name) {
+	case ArrivalFixed, ArrivalPoisson:
+		if hasShape {
+			return "", 0, fmt.Errorf("%s does not take a shape", name)
+		}
+		return ArrivalProcess(name), 0, nil
+	case ArrivalPareto, ArrivalLognormal:
+		if !hasShape {
+			return ArrivalProcess(name), 0, nil
+		}
+		v, err := strconv.ParseFloat(shape, 64)
+		if err != nil {
+			return "", 0, fmt.Errorf("%s shape must be a number: %w", name, err)
+		}
+		if v <= 0 {
+			// 0 is how LoadConfig asks for the default, an explicit shape has to be a real one
+			return "", 0, fmt.Errorf("%s shape must be positive, got %v", name, v)
+		}
+		return ArrivalProcess(name), v, nil
+	}
+	return "", 0, fmt.Errorf("unknown arrival process %q", s)
+}
@@ -12,7 +12,11 @@ import (
 
 const helpMessage = `
 Usage:
-  ./main [option] [arguments]
+  ./main [-out <directory>] [-run <run-id>] [option] [arguments]
+
+  -out and -run choose where experiment artifacts (timeframe.jsonl) are read from,
+  <directory>/<run-id>. The default is ../json_results with no run ID.
+  Use the same -out and -run that the server was started with.
 
 Options:
   -s:
@@ -27,7 +31,7 @@ Options:
 
   -lt:
     Conduct a single load test and add the data to a file.
-    Format:  ./main -lt <server:port> <Rate> <Duration> <Seed> <Mode> <HeavyMix%> <ResultFileName>
+    Format:  ./main -lt <server:port> <Rate> <Duration> <Seed> <Mode> <HeavyMix%> <ResultFileName> [Options...]
 
     Descriptions:
       <Rate>          The number of requests per second.
@@ -42,12 +46,88 @@ Options:
       <HeavyMix%>     A value from 0 to 100, indicating the percentage chance of "heavy" requests.
       <ResultFileName>  The JSONL file where results will be stored.
                         (Created if it does not exist.)
+                        Every request is also recorded in <ResultFileName>_requests.jsonl.
+                        Mixed tests also append one summary per operation after the aggregate.
+      [Options]       Any of the following, in any order:
+                      Connections, how requests reach the server (default per-request):
+                        per-request → a new connection for every request
+                        pool:<N>    → N persistent connections, one request at a time on each
+                        multiplex   → one persistent connection shared by every request
+                      Arrival process, the gaps between requests averaging <Rate> (default fixed):
+                        fixed             → evenly spaced
+                        poisson           → exponential gaps
+                        pareto[:alpha]    → heavy tailed gaps, alpha above 1 (default 1.5)
+                        lognormal[:sigma] → heavy tailed gaps (default sigma 1)
+                      Rate profile, one continuous test whose offered rate changes over time.
+                      <Rate> is ignored and the summary records the average offered rate.
+                      The offered and achieved rate per second is written to <ResultFileName>_rates.jsonl:
+                        ramp:<low>:<high>                → linear from low to high over the test
+                        step:<low>:<high>:<at>           → low until at, then high
+                        spike:<low>:<high>:<at>:<length> → low, except high for length starting at at
+                        sine:<low>:<high>:<period>       → swings between low and high once every period
+                      Times are durations, e.g. 5s or 500ms.
+                      Operation mix, weighted instead of <Mode>:
+                        mix:<op>=<weight>,...            → e.g. mix:hash=50,sort=30,matmul=15,zlib=5
+                      Payload sizes, generated payloads instead of the fixed heavy and light ones.
+                      A size is bytes for hash and zlib, elements for sort and the matrix side for matmul:
+                        size:[<op>:]<dist>[,...]         → op is hash, matmul, zlib or sort, otherwise every operation
+                        fixed:<size>                     → every payload the same size
+                        uniform:<min>:<max>              → evenly spread from min to max
+                        bimodal:<small>:<large>:<large%> → small, except large% of the payloads are large
+                        lognormal:<median>[:<sigma>]     → heavy tailed around median (default sigma 1)
+                      Schedule, the whole request schedule is worked out from <Seed> before the test starts:
+                        schedule:<file>  → also write it to file in the -replay trace format
+                      Deadline, without one a request waits for its reply forever:
+                        timeout:<d>      → fail a request with no reply after d, e.g. timeout:500ms
+                      Warmup and cooldown, requests sent around <Duration> that the summary leaves out:
+                        warmup:<d>       → send for d before the summarized window, e.g. warmup:500ms
+                        cooldown:<d>     → keep sending for d after it
+                        timeframe:<label> → have the server record the summarized window as a timeframe
 
     Example:
       ./main -lt localhost:1234 10 5 1 0 25 result
       → Runs a load test at localhost:1234 doing 10 requests/sec for 5 seconds.
         Uses seed=1, mode=0 (mixed operations), with 25% heavy requests.
         Results saved to result.jsonl.
+      ./main -lt localhost:1234 10 5 1 0 25 result pool:8 poisson
+      → The same load test sent over 8 persistent connections with Poisson arrivals.
+      ./main -lt localhost:1234 0 30 1 0 25 result ramp:100:2000
+      → One 30 second test whose rate climbs from 100 to 2000 requests/sec.
+
+  -slo:
+    Search for the highest rate whose latency percentile stays under an SLO, probing with load tests and bisecting.
+    Format:  ./main -slo <server:port> <Percentile> <SLO_ms> <Duration> <Seed> <Mode> <HeavyMix%> <ResultFileName> [Options...]
+
+    Descriptions:
+      <Percentile>    e.g. 99 or 99.9, judged on the corrected response time with failed requests counted as slowest.
+      <SLO_ms>        The latency the percentile must stay under.
+      The other arguments and options are as for -lt, plus:
+                        start:<rate>   → rate of the first probe (default 100)
+                        max:<rate>     → highest rate the search tries (default 100000)
+                        precision:<n>  → stop once pass and failure are n req/s apart (default 5%)
+                        repeats:<n>    → load tests per probe before it may decide (default 2, at most 5)
+                        op:<name>      → judge only this operation of a mixed test, one the mode or mix sends
+      The result is appended to <ResultFileName>_slo.jsonl.
+
+  -replay:
+    Replay an arrival trace against the server at its original timing and add the summary to a file.
+    Format:  ./main -replay <server:port> <TraceFile> <ResultFileName> [Speedup] [Connections] [timeout:<d>]
+
+    Descriptions:
+      <TraceFile>     A .jsonl or .csv file with one request per line:
+                        offset_ms → when to send it, milliseconds from the start of the trace
+                        op        → hash, matmul, zlib or sort
+                        heavy     → true for the heavy payload (optional)
+                        size      → generate a payload of this many bytes/elements instead, the matrix side for matmul (optional)
+                        args      → JSON sent as the RPC arguments as-is (optional)
+                      A CSV trace needs a header row naming its columns.
+      [Speedup]       Replay this many times faster than recorded (default 1).
+      [Connections]   per-request, pool:<N> or multiplex, as for -lt.
+      [timeout:<d>]   Per request deadline, as for -lt.
+
+    Example:
+      ./main -replay localhost:1234 prod.jsonl replay 2 pool:8
+      → Replays prod.jsonl at twice its speed over 8 connections, results saved to replay.jsonl.
 
   -g:
     Create graphs (Average, 50th, 95th, and 99th Percentiles) for a conducted load test.
@@ -57,7 +137,55 @@ Options:
     Print the summary data used to create load test graphs to the console.
     Format:  ./main -pg <filename>
 
-Pre-Prepared Load Tests:
+  -idump:
+    Dump the server's instrumentation logs to a directory on the server without shutting it down.
+    Format:  ./main -idump <server:port> <Directory> [Message]
+
+  -ireset:
+    Drain the server's instrumentation logs into <out>/phase_<n> on the server and start over,
+    the next dump only holds events from after the reset.
+    Format:  ./main -ireset <server:port>
+
+  -icount:
+    Print how many events each of the server's instrumentation logs holds since the last reset.
+    The runtime's own logs are counted as of the last -idump, they are not dumped just to be counted.
+    Format:  ./main -icount <server:port>
+
+  -rates:
+    Graph the target, offered and achieved rate per second of the rate profile tests in a _rates.jsonl file.
+    Format:  ./main -rates <result_rates.jsonl>
+
+  -rtmetrics:
+    Graph the server's runtime/metrics samples (goroutines, scheduling latency and GC) over the experiment timeframes.
+    Format:  ./main -rtmetrics <runtime_metrics.jsonl>
+
+  -begin / -end:
+    Begin or end a named timeframe on the server, recorded with the server's clock.
+    The timeframes are dumped to timeframe.jsonl with the rest of the instrumentation logs.
+    Format:  ./main -begin <server:port> <Label>
+             ./main -end <server:port> <Label>
+
+  -trace:
+    Record a runtime/trace on the server for the given number of seconds into <label>_trace.out in its run directory.
+    Convert it with traceconv to use -inst and -gstat on it. The label defaults to the server's current time.
+    Format:  ./main -trace <server:port> <Seconds> [Label]
+
+  -profile:
+    Record a CPU profile on the server for the given number of seconds, then snapshot the goroutine and mutex profiles.
+    Written to <label>_cpu.pprof, <label>_goroutine.pprof and <label>_mutex.pprof in its run directory, open them with go tool pprof.
+    Format:  ./main -profile <server:port> <Seconds> [Label]
+
+  -knee:
+    Estimate where each operation of a rate sweep saturates, from where throughput falls behind or p99 bends upward.
+    Prints the capacity per operation and circles it on the -g graphs.
+    Format:  ./main -knee <filename>
+
+  -spec:
+    Run an experiment described by a JSON spec file, see specs/ and the README for the fields.
+    A name such as lt1 or expr3 runs the bundled spec of that pre-prepared test.
+    Format:  ./main -spec <server:port> <file.json>
+
+Pre-Prepared Load Tests (bundled specs in specs/):
    -lt1 --> Rates from 100 to 2000 requests per second increasing in intervals of 100 req/s. Lasts one second for every request mode, zero chance of large requests. 
    			Stores results in load_test_eg1.jsonl
    -lt2 --> Rates from 400 to 1200 requests per second increasing in intervals of 100 req/s. Lasts one second for every request mode, zero chance of large requests. 
@@ -66,6 +194,7 @@ Pre-Prepared Load Tests:
 			Stores results in load_test_eg3.jsonl
    -lt4 --> Rates from 400 to 1200 requests per second increasing in intervals of 100 req/s. Lasts one second for every request mode, 100 percent chance of large requests. 
 			Stores results in load_test_eg4.jsonl
+   Each run also sends 500ms of warmup requests first, they are not in the summary.
 
 	`
 
@@ -145,23 +274,83 @@ type ShutdownArgs struct {
 	Message string
 }
 
+type ExperimentArgs struct {
+	Label string
+}
+
+type ProfileArgs struct {
+	Seconds int
+	Label   string
+}
+
+type ProfileFiles struct {
+	Files []string
+}
+
+type InstrumentationDumpArgs struct {
+	Dir     string
+	Message string
+}
+
+type InstrumentationArgs struct{}
+
+type EventCounts struct {
+	Counts   map[string]int // events per log file since the last reset
+	Since    int64          // runtime timestamp of the last reset, 0 if never reset
+	Dir      string         // where Reset drained the logs recorded before it
+	DumpedAt int64          // when the runtime logs in Counts were dumped, 0 if they have not been since the reset
+}
+
 type LoadConfig struct {
 	Address    string        // server address, e.g. "localhost:1234"
 	Rate       int           // requests per second
-	Duration   time.Duration // how long to run
+	Duration   time.Duration // how long to run, the steady state window the Summary covers
+	Warmup     time.Duration // requests sent before Duration starts, left out of the Summary
+	Cooldown   time.Duration // requests sent after Duration ends, left out of the Summary
+	Timeframe  string        // when set the server records the steady state window as a timeframe with this label
 	Seed       int64         // randomness seed
 	Mode       int           // what mix of requests to have
+	Mix        string        // weighted operation mix such as hash=50,sort=30,matmul=15,zlib=5, replaces Mode when set
 	HeavyMix   int           // val from 0 to 100, percentage chance of requests that are "heavy"
 	ResultFile string        // the location where the results of the load test will go
+
+	Connections ConnStrategy  // how requests reach the server, empty is ConnPerRequest
+	PoolSize    int           // number of persistent connections when Connections is ConnPool
+	Timeout     time.Duration // deadline of each request including its dial, 0 waits forever
+
+	Arrival      ArrivalProcess // how the gaps between requests are drawn, empty is ArrivalFixed
+	ArrivalShape float64        // pareto alpha or lognormal sigma, 0 uses the default
+
+	Profile RateProfile // offered rate over time, replaces Rate when its Shape is set
+
+	Sizes PayloadSizes // payload size distribution per operation, operations without one use HeavyMix
+
+	ScheduleFile string // when set the precomputed request schedule is written here as an arrival trace
+
+	Trace   string  // arrival trace that was replayed instead of generating requests, see readArrivalTrace
+	Speedup float64 // how many times faster than recorded the trace was replayed
 }
 
 type Result struct {
-	Latency time.Duration
-	Error   error
+	Op     string // hash, matmul, zlib or sort
+	Heavy  bool   // the heavy payload was sent
+	Size   int    // bytes or elements of the payload, the matrix side for matmul
+	ConnID int64  // the connection the request went out on
+
+	Latency     time.Duration // service latency, from when the request was actually sent until the reply
+	Corrected   time.Duration // response time from when the schedule intended the request to be sent, includes any client side delay
+	TestStart   time.Time     // when the test started, the offsets below are from here
+	ServerStart int64         // the server's clock when the test started, 0 when it could not be read
+	Scheduled   time.Duration // when the request was meant to be sent, since the test started
+	Start       time.Duration // when the request was actually sent, since the test started
+	Done        time.Duration // when the reply arrived, since the test started
+	Error       error
 }
 
 type Summary struct {
 	Operation  string  `json:"operation"`
+	TestID     string  `json:"test_id,omitempty"` // start time of the load test, shared by its aggregate and per operation summaries
+	Op         string  `json:"op,omitempty"`      // set on the per operation summaries of a test that sent several operations
 	Seed       int64   `json:"seed"`
 	Rate       int     `json:"rate"`   // requests per second
 	AvgLatency float64 `json:"avg_ms"` // average in ms
@@ -170,9 +359,40 @@ type Summary struct {
 	P99Latency float64 `json:"p99_ms"`
 	Throughput float64 `json:"throughput"` // successful req/s
 	Errors     int     `json:"errors"`
+
+	ErrorClasses map[string]int            `json:"error_classes,omitempty"` // failed requests by class, see errorClass
+	OpErrors     map[string]map[string]int `json:"op_errors,omitempty"`     // failed requests by operation and then class
+
+	P999Latency  float64    `json:"p999_ms,omitempty"`
+	P9999Latency float64    `json:"p9999_ms,omitempty"`
+	LatencyHist  *Histogram `json:"latency_hist,omitempty"` // every successful latency, -g plots the full percentile spectrum from it
+
+	// percentiles of the response time measured from each request's intended send time,
+	// corrects for coordinated omission when the client falls behind its schedule
+	CorrectedP50  float64    `json:"corrected_p50_ms"`
+	CorrectedP95  float64    `json:"corrected_p95_ms"`
+	CorrectedP99  float64    `json:"corrected_p99_ms"`
+	CorrectedHist *Histogram `json:"corrected_hist,omitempty"`
+
+	Connections string  `json:"connections,omitempty"` // connection strategy, e.g. per-request, pool:8 or multiplex
+	Arrival     string  `json:"arrival,omitempty"`     // arrival process and its shape, e.g. fixed, poisson or pareto:1.5
+	Profile     string  `json:"profile,omitempty"`     // rate profile, e.g. ramp:100:2000, rate is then the average offered rate
+	Trace       string  `json:"trace,omitempty"`       // replayed arrival trace, rate is then the average offered rate
+	Speedup     float64 `json:"speedup,omitempty"`     // how many times faster than recorded the trace was replayed
+	Warmup      float64 `json:"warmup_s,omitempty"`    // seconds of requests sent before the summarized window
+	Cooldown    float64 `json:"cooldown_s,omitempty"`  // seconds of requests sent after the summarized window
+	Mix         string  `json:"mix,omitempty"`         // weighted operation mix as given, e.g. hash=50,sort=30,matmul=15,zlib=5
+	Sizes       string  `json:"sizes,omitempty"`       // payload size distributions, e.g. uniform:100:1000 or lognormal:1000:1,matmul:fixed:32
+	MeanSize    float64 `json:"mean_size,omitempty"`   // average bytes, elements or matrix side of the payloads sent
+
+	// replies per second that arrived before the steady window ended, over Duration. Unlike throughput a late reply
+	// does not count, so it falls behind the offered rate once the server does
+	Achieved float64 `json:"achieved_rps,omitempty"`
+	Duration float64 `json:"duration_s,omitempty"` // seconds in the steady window, the requests offered over it are the offered rate
 }
 
 type Timeframe struct {
+	Label string // phase this timeframe belongs to e.g. warmup, steady or overload
 	Start int64
 	End   int64
 }
@@ -356,6 +576,17 @@ type GState struct {
 	hasReady  bool  // did we see a READY that is awaiting a RUNNING?
 }
 
+// Copy of the server's runtime/metrics sample
+type RuntimeMetricsSample struct {
+	Timestamp         int64              // timestamp (nanoseconds), the same clock as the timeframes
+	Goroutines        uint64             // live goroutines
+	SchedLatencyCount uint64             // goroutines that were scheduled since the previous sample
+	SchedLatencyP50   float64            // scheduling latency percentiles since the previous sample (seconds), 0 if none
+	SchedLatencyP95   float64            //
+	SchedLatencyP99   float64            //
+	GC                map[string]float64 // every scalar /gc/* metric by name
+}
+
 type CycleEvent struct {
 	Timestamp   int64  // timestamp (nanoseconds)
 	GoRoutineID int64  // goroutine ID
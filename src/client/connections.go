@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+
+	Connection strategies for the load generator, so connection churn can be told apart from per-RPC scheduling
+
+*/
+
+type ConnStrategy string
+
+const (
+	ConnPerRequest ConnStrategy = "per-request" // dial a new connection for every request, the original behavior
+	ConnPool       ConnStrategy = "pool"        // a fixed pool of persistent connections, one request at a time on each
+	ConnMultiplex  ConnStrategy = "multiplex"   // one persistent connection, every request is sent on it with client.Go
+)
+
+// rpcConn sends one request to the server with whatever connection strategy it was made for,
+// call returns the ID of the connection the request went out on
+type rpcConn interface {
+	call(method string, args any, reply any) (int64, error)
+	close()
+}
+
+// errDeadline is the error of a request that got no reply within LoadConfig.Timeout
+var errDeadline = errors.New("request deadline exceeded")
+
+// every connection the client dials gets the next ID
+var connIDs atomic.Int64
+
+// a client and the ID of the connection under it
+type idClient struct {
+	*rpc.Client
+	id int64
+}
+
+func newRPCConn(cfg LoadConfig) (rpcConn, error) {
+	switch cfg.Connections {
+	case "", ConnPerRequest:
+		return perRequestConn{cfg.Address, cfg.Timeout}, nil
+	case ConnPool:
+		if cfg.PoolSize <= 0 {
+			return nil, errors.New("a connection pool needs a size of at least 1")
+		}
+		pool := &poolConn{addr: cfg.Address, timeout: cfg.Timeout, free: make(chan *idClient, cfg.PoolSize)}
+		for i := 0; i < cfg.PoolSize; i++ {
+			client, err := dialRPC(cfg.Address, cfg.Timeout)
+			if err != nil {
+				pool.close()
+				return nil, err
+			}
+			pool.free <- client
+		}
+		return pool, nil
+	case ConnMultiplex:
+		client, err := dialRPC(cfg.Address, cfg.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		return &multiplexConn{addr: cfg.Address, timeout: cfg.Timeout, client: client}, nil
+	default:
+		return nil, fmt.Errorf("unknown connection strategy %q", cfg.Connections)
+	}
+}
+
+// parseConnStrategy reads "per-request", "multiplex" or "pool:<N>"
+func parseConnStrategy(s string) (ConnStrategy, int, error) {
+	name, size, hasSize := strings.Cut(s, ":")
+	switch ConnStrategy(name) {
+	case ConnPerRequest, ConnMultiplex:
+		if hasSize {
+			return "", 0, fmt.Errorf("%s does not take a size", name)
+		}
+		return ConnStrategy(name), 0, nil
+	case ConnPool:
+		n, err := strconv.Atoi(size)
+		if err != nil || n <= 0 {
+			return "", 0, fmt.Errorf("pool needs a size, e.g. pool:8")
+		}
+		return ConnPool, n, nil
+	}
+	return "", 0, fmt.Errorf("unknown connection strategy %q", s)
+}
+
+// dialRPC gives up after timeout, 0 waits as long as the operating system does
+func dialRPC(addr string, timeout time.Duration) (*idClient, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &idClient{jsonrpc.NewClient(conn), connIDs.Add(1)}, nil
+}
+
+// deadline is when a request started at start runs out of time, the zero time when there is no timeout
+func deadline(start time.Time, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return start.Add(timeout)
+}
+
+// wait returns the error of call, or errDeadline if the reply has not arrived by the deadline
+func wait(call *rpc.Call, by time.Time) error {
+	if by.IsZero() {
+		<-call.Done // wait for response
+		return call.Error
+	}
+	timer := time.NewTimer(time.Until(by))
+	defer timer.Stop()
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-timer.C:
+		return errDeadline
+	}
+}
+
+// the connection is gone rather than the server returning an error for this request
+func isConnBroken(err error) bool {
+	return errors.Is(err, rpc.ErrShutdown) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// perRequestConn measures the TCP setup and a fresh rpc.ServeCodec goroutine on the server with every request
+type perRequestConn struct {
+	addr    string
+	timeout time.Duration
+}
+
+func (c perRequestConn) call(method string, args any, reply any) (int64, error) {
+	by := deadline(time.Now(), c.timeout)
+	client, err := dialRPC(c.addr, c.timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	call := client.Go(method, args, reply, nil)
+	return client.id, wait(call, by)
+}
+
+func (c perRequestConn) close() {}
+
+// poolConn hands out each connection to one request at a time,
+// waiting for a free connection is part of the request's latency
+type poolConn struct {
+	addr    string
+	timeout time.Duration
+	free    chan *idClient // nil entries are connections that broke and get redialed on their next use
+}
+
+func (p *poolConn) call(method string, args any, reply any) (int64, error) {
+	by := deadline(time.Now(), p.timeout)
+	var client *idClient
+	if by.IsZero() {
+		client = <-p.free
+	} else {
+		timer := time.NewTimer(time.Until(by))
+		defer timer.Stop()
+		select {
+		case client = <-p.free:
+		case <-timer.C:
+			return 0, errDeadline
+		}
+	}
+	if client == nil {
+		timeout := p.timeout
+		if !by.IsZero() {
+			timeout = time.Until(by) // waiting for the connection used up part of the deadline
+		}
+		var err error
+		client, err = dialRPC(p.addr, timeout)
+		if err != nil {
+			p.free <- nil
+			return 0, err
+		}
+	}
+
+	id := client.id
+	err := wait(client.Go(method, args, reply, nil), by)
+	if isConnBroken(err) || errors.Is(err, errDeadline) {
+		// a connection still waiting on a late reply would no longer carry one request at a time
+		client.Close()
+		client = nil
+	}
+	p.free <- client
+	return id, err
+}
+
+func (p *poolConn) close() {
+	for {
+		select {
+		case client := <-p.free:
+			if client != nil {
+				client.Close()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// multiplexConn sends every request on one connection, the server reads them with a single rpc.ServeCodec goroutine
+type multiplexConn struct {
+	addr    string
+	timeout time.Duration
+	mu      sync.Mutex
+	client  *idClient
+}
+
+func (m *multiplexConn) call(method string, args any, reply any) (int64, error) {
+	by := deadline(time.Now(), m.timeout)
+	m.mu.Lock()
+	client := m.client
+	m.mu.Unlock()
+
+	// a reply that arrives after the deadline is dropped by the client, the connection stays usable
+	err := wait(client.Go(method, args, reply, nil), by)
+	if isConnBroken(err) {
+		m.redial(client)
+	}
+	return client.id, err
+}
+
+// redial replaces a broken client, unless another request already has
+func (m *multiplexConn) redial(broken *idClient) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.client != broken {
+		return
+	}
+	client, err := dialRPC(m.addr, m.timeout)
+	if err != nil {
+		return
+	}
+	broken.Close()
+	m.client = client
+}
+
+func (m *multiplexConn) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.client.Close()
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"time"
+)
+
+/*
+
+	High dynamic range latency histogram. Every latency is kept to 3 significant figures in nanoseconds with a
+	fixed amount of memory per power of two, so long runs cost no more than short ones, histograms of separate
+	runs can be merged and any quantile (p99.9, p99.99) can be read back out.
+
+*/
+
+const (
+	histSubBuckets    = 2048 // smallest power of two holding 2 * 10^3 values, so each bucket is within 0.1%
+	histSubHalf       = histSubBuckets / 2
+	histSubHalfBits   = 10 // log2(histSubHalf)
+	histSubBucketMask = histSubBuckets - 1
+)
+
+type Histogram struct {
+	counts []int64 // grows as larger values are recorded
+	total  int64
+	min    int64
+	max    int64
+}
+
+func newHistogram() *Histogram {
+	return &Histogram{min: math.MaxInt64}
+}
+
+// histIndex is the counts slot of v, slots below histSubBuckets hold one nanosecond each and
+// every power of two above that is split into histSubHalf slots
+func histIndex(v int64) int {
+	bucket := 64 - bits.LeadingZeros64(uint64(v)|histSubBucketMask) - (histSubHalfBits + 1)
+	sub := int(v >> uint(bucket))
+	return (bucket+1)<<histSubHalfBits + sub - histSubHalf
+}
+
+// histValue is the lowest value that lands in slot i
+func histValue(i int) int64 {
+	bucket := i>>histSubHalfBits - 1
+	sub := int64(i&(histSubHalf-1)) + histSubHalf
+	if bucket < 0 {
+		sub -= histSubHalf
+		bucket = 0
+	}
+	return sub << uint(bucket)
+}
+
+// histHighest is the highest value that lands in slot i
+func histHighest(i int) int64 {
+	return histValue(i+1) - 1
+}
+
+func (h *Histogram) recordCount(v int64, n int64) {
+	if v < 0 {
+		v = 0
+	}
+	i := histIndex(v)
+	if i >= len(h.counts) {
+		grown := make([]int64, i+histSubHalf)
+		copy(grown, h.counts)
+		h.counts = grown
+	}
+	h.counts[i] += n
+	h.total += n
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+}
+
+func (h *Histogram) record(d time.Duration) {
+	h.recordCount(int64(d), 1)
+}
+
+// merge adds every value recorded in other to h
+func (h *Histogram) merge(other *Histogram) {
+	if other == nil || other.total == 0 {
+		return
+	}
+	for i, n := range other.counts {
+		if n > 0 {
+			h.recordCount(histValue(i), n)
+		}
+	}
+	// keep the exact extremes rather than the bucket values they were merged in as
+	if other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+}
+
+func (h *Histogram) count() int64 {
+	return h.total
+}
+
+// quantile returns the value at q (0 to 1), interpolated between the recorded values either
+// side of rank 1 + q * (N - 1) so q = 0 is the minimum and q = 1 the maximum, NaN when nothing was recorded
+func (h *Histogram) quantile(q float64) float64 {
+	if h.total == 0 {
+		return math.NaN()
+	}
+	return h.atRank(1 + q*float64(h.total-1))
+}
+
+// atRank returns the value at rank counting from 1, interpolated between the neighbouring whole ranks
+// when rank has a fraction, clamped to the recorded values
+func (h *Histogram) atRank(rank float64) float64 {
+	if h.total == 0 {
+		return math.NaN()
+	}
+	if rank <= 1 {
+		return h.valueAt(1)
+	}
+	if rank >= float64(h.total) {
+		return h.valueAt(h.total)
+	}
+	below := math.Floor(rank)
+	v := h.valueAt(int64(below))
+	if frac := rank - below; frac > 0 {
+		v += frac * (h.valueAt(int64(below)+1) - v)
+	}
+	return v
+}
+
+// valueAt returns the rank'th smallest recorded value counting from 1, as the highest value of its slot
+// clamped to the recorded values
+func (h *Histogram) valueAt(rank int64) float64 {
+	var seen int64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			v := histHighest(i)
+			if v > h.max {
+				v = h.max
+			}
+			if v < h.min {
+				v = h.min
+			}
+			return float64(v)
+		}
+	}
+	return float64(h.max)
+}
+
+// String keeps logged summaries readable
+func (h *Histogram) String() string {
+	return fmt.Sprintf("histogram of %d values", h.total)
+}
+
+// quantileMs is quantile in milliseconds, the unit of the Summary
+func (h *Histogram) quantileMs(q float64) float64 {
+	return h.quantile(q) / float64(time.Millisecond)
+}
+
+// the result file form, only the slots that were hit as [lowest value in ns, count] pairs
+type histogramJSON struct {
+	Count   int64      `json:"count"`
+	MinNs   int64      `json:"min_ns"`
+	MaxNs   int64      `json:"max_ns"`
+	Buckets [][2]int64 `json:"buckets"`
+}
+
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	out := histogramJSON{Count: h.total, Buckets: [][2]int64{}}
+	if h.total > 0 {
+		out.MinNs, out.MaxNs = h.min, h.max
+	}
+	for i, n := range h.counts {
+		if n > 0 {
+			out.Buckets = append(out.Buckets, [2]int64{histValue(i), n})
+		}
+	}
+	return json.Marshal(out)
+}
+
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	var in histogramJSON
+	err := json.Unmarshal(data, &in)
+	if err != nil {
+		return err
+	}
+	*h = *newHistogram()
+	for _, b := range in.Buckets {
+		h.recordCount(b[0], b[1])
+	}
+	if h.total != in.Count {
+		return fmt.Errorf("histogram count is %d but its buckets hold %d", in.Count, h.total)
+	}
+	if h.total > 0 {
+		h.min, h.max = in.MinNs, in.MaxNs
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+)
+
+/*
+
+	Saturation detection over a sweep of Summary lines, finds the offered rate each operation stops keeping up at
+
+*/
+
+const (
+	// throughput has diverged from the offered rate once the achieved rate is below this share of it
+	kneeThroughputRatio = 0.95
+	// a p99 knee only counts if p99 grows at least this many times past it, a flat but noisy curve has no knee
+	kneeLatencyGrowth = 2.0
+)
+
+type Knee struct {
+	Operation      string
+	Capacity       float64 // highest tested rate before either sign of saturation, the estimate
+	ThroughputRate float64 // first rate where throughput diverged from the offered rate, 0 if it never did
+	LatencyRate    float64 // rate at the p99 knee, 0 if there is none
+	MaxRate        float64 // highest rate tested
+}
+
+// saturated is true when the sweep went past the capacity, otherwise the capacity is only a lower bound
+func (k Knee) saturated() bool {
+	return k.ThroughputRate > 0 || k.LatencyRate > 0
+}
+
+// one tested rate, summaries at the same rate (other seeds or repetitions) averaged
+type kneePoint struct {
+	rate       float64
+	efficiency float64 // achieved rate over offered rate
+	p99        float64
+}
+
+// efficiency is the achieved rate, replies that arrived inside the test window, over the offered rate.
+// The offered rate is counted from the requests the summary covers rather than taken from rate,
+// so it works for the per operation lines of a mixed test whose rate is the whole test's.
+func efficiency(s Summary) float64 {
+	if s.Duration > 0 && s.LatencyHist != nil {
+		offered := (float64(s.LatencyHist.count()) + float64(s.Errors)) / s.Duration
+		if offered == 0 {
+			return 1
+		}
+		return s.Achieved / offered
+	}
+	// result files written before the achieved rate was recorded, late replies count as keeping up
+	if s.LatencyHist != nil {
+		n := float64(s.LatencyHist.count())
+		return n / (n + float64(s.Errors))
+	}
+	return s.Throughput / float64(s.Rate)
+}
+
+func kneePoints(list []Summary) []kneePoint {
+	sums := make(map[int]*kneePoint)
+	counts := make(map[int]int)
+	for _, s := range list {
+		if math.IsNaN(s.P99Latency) || s.Rate <= 0 {
+			continue
+		}
+		if sums[s.Rate] == nil {
+			sums[s.Rate] = &kneePoint{rate: float64(s.Rate)}
+		}
+		sums[s.Rate].efficiency += efficiency(s)
+		sums[s.Rate].p99 += s.P99Latency
+		counts[s.Rate]++
+	}
+
+	points := make([]kneePoint, 0, len(sums))
+	for rate, pt := range sums {
+		n := float64(counts[rate])
+		points = append(points, kneePoint{pt.rate, pt.efficiency / n, pt.p99 / n})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].rate < points[j].rate })
+	return points
+}
+
+// latencyKnee finds the point of maximum curvature of p99 against rate (the Kneedle method):
+// with both axes scaled to 0-1 it is the point furthest below the straight line from the first to the last point
+func latencyKnee(points []kneePoint) int {
+	if len(points) < 3 {
+		return -1
+	}
+	first, last := points[0], points[len(points)-1]
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, pt := range points {
+		lo, hi = math.Min(lo, pt.p99), math.Max(hi, pt.p99)
+	}
+	if hi <= lo {
+		return -1
+	}
+
+	knee, best := -1, 0.0
+	for i, pt := range points {
+		x := (pt.rate - first.rate) / (last.rate - first.rate)
+		y := (pt.p99 - lo) / (hi - lo)
+		if x-y > best {
+			knee, best = i, x-y
+		}
+	}
+	if knee < 0 || hi < kneeLatencyGrowth*points[knee].p99 {
+		return -1
+	}
+	return knee
+}
+
+// findKnees estimates the capacity of every operation in a sweep
+func findKnees(data []Summary) map[string]Knee {
+	grouped := make(map[string][]Summary)
+	for _, s := range data {
+		grouped[s.Operation] = append(grouped[s.Operation], s)
+	}
+
+	knees := make(map[string]Knee)
+	for op, list := range grouped {
+		points := kneePoints(list)
+		if len(points) == 0 {
+			continue
+		}
+		k := Knee{Operation: op, Capacity: points[len(points)-1].rate, MaxRate: points[len(points)-1].rate}
+
+		for i, pt := range points {
+			if pt.efficiency < kneeThroughputRatio {
+				k.ThroughputRate = pt.rate
+				if i > 0 {
+					k.Capacity = points[i-1].rate
+				} else {
+					k.Capacity = pt.rate
+				}
+				break
+			}
+		}
+		if i := latencyKnee(points); i >= 0 {
+			k.LatencyRate = points[i].rate
+			k.Capacity = math.Min(k.Capacity, k.LatencyRate)
+		}
+		knees[op] = k
+	}
+	return knees
+}
+
+func printKnees(knees map[string]Knee) {
+	ops := make([]string, 0, len(knees))
+	for op := range knees {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+
+	fmt.Println("\n Capacity by Operation:")
+	for _, op := range ops {
+		k := knees[op]
+		fmt.Printf("\nOperation: %s\n", op)
+		if !k.saturated() {
+			fmt.Printf("\tno saturation up to %.0f req/s, capacity is at least that\n", k.MaxRate)
+			continue
+		}
+		fmt.Printf("\tcapacity estimate: %.0f req/s\n", k.Capacity)
+		if k.ThroughputRate > 0 {
+			fmt.Printf("\tthroughput falls behind the offered rate at %.0f req/s\n", k.ThroughputRate)
+		} else {
+			fmt.Printf("\tthroughput keeps up with the offered rate up to %.0f req/s\n", k.MaxRate)
+		}
+		if k.LatencyRate > 0 {
+			fmt.Printf("\tp99 knee at %.0f req/s\n", k.LatencyRate)
+		} else {
+			fmt.Println("\tno p99 knee")
+		}
+	}
+}
+
+// addKneeMark circles the capacity estimate of op on a plot of value against rate, nothing is drawn without knees
+func addKneeMark(p *plot.Plot, knee Knee, list []Summary, col color.Color, value func(Summary) float64) {
+	if !knee.saturated() {
+		return
+	}
+	sum, n := 0.0, 0
+	for _, s := range list {
+		if float64(s.Rate) == knee.Capacity && !math.IsNaN(value(s)) {
+			sum += value(s)
+			n++
+		}
+	}
+	if n == 0 {
+		return
+	}
+
+	mark, _ := plotter.NewScatter(plotter.XYs{{X: knee.Capacity, Y: sum / float64(n)}})
+	mark.GlyphStyle = draw.GlyphStyle{Color: col, Radius: vg.Points(6), Shape: draw.RingGlyph{}}
+	p.Add(mark)
+	p.Legend.Add(fmt.Sprintf("%s capacity %.0f req/s", knee.Operation, knee.Capacity), mark)
+}
@@ -10,9 +10,8 @@ import (
 	"net/rpc"
 	"net/rpc/jsonrpc"
 	"os"
-	"runtime/instrumentation_export"
-	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -23,137 +22,172 @@ Load Test Helper Functions
 
 */
 
-func sendHashLoadTest(cfg LoadConfig, stateSeed int64) error {
-	conn, err := net.Dial("tcp", cfg.Address)
+func sendShutdown(serverAddr string, msg string) {
+	// Connect to the server
+	conn, err := net.Dial("tcp", serverAddr)
 	if err != nil {
-		return err
+		log.Fatal("Dialing:", err)
 	}
 	defer conn.Close()
 
+	// Create JSON-RPC client
 	client := jsonrpc.NewClient(conn)
+	defer client.Close()
 
-	randGen := rand.New(rand.NewSource(stateSeed))
-	choice := randGen.Intn(100 - (0 + 1)) // rand int between 0 and 100
-
-	var hashReply string // there may be a race here lol
-	var hargs HashArgs
-	if choice < cfg.HeavyMix {
-		// do a heavy operation
-		hargs = HashArgs{[]byte("As the blue one says, Gotta go fast"), 14}
-	} else {
-		hargs = HashArgs{[]byte(LARGE_TEXT), 14}
+	// Get Hash
+	var reply string
+	sargs := ShutdownArgs{msg}
+	err = client.Call("Shutdown.Exit", sargs, &reply)
+	if err != nil {
+		log.Fatal("Hash Compute error: ", err)
 	}
-
-	call := client.Go("GetHash.HashCompute", hargs, &hashReply, nil)
-
-	<-call.Done // wait for response
-	return call.Error
+	log.Printf("Shutdown Response: %s\n", reply)
 }
 
-func sendMatMuxLoadTest(cfg LoadConfig, stateSeed int64) error {
-	conn, err := net.Dial("tcp", cfg.Address)
+func sendInstrumentationDump(serverAddr string, dir string, msg string) {
+	conn, err := net.Dial("tcp", serverAddr)
 	if err != nil {
-		return err
+		log.Fatal("Dialing:", err)
 	}
 	defer conn.Close()
 
 	client := jsonrpc.NewClient(conn)
+	defer client.Close()
 
-	randGen := rand.New(rand.NewSource(stateSeed))
-	choice := randGen.Intn(100 - (0 + 1)) // rand int between 0 and 100
-	var matmutArgs MatMutArgs
-	var arr1, arr2, matReply []float64
+	var reply EventCounts
+	dargs := InstrumentationDumpArgs{dir, msg}
+	err = client.Call("Instrumentation.Dump", dargs, &reply)
+	if err != nil {
+		log.Fatal("Instrumentation Dump error: ", err)
+	}
+	log.Printf("Instrumentation logs dumped to %s: %v\n", dir, reply.Counts)
+}
 
-	if choice < cfg.HeavyMix {
-		arr1 = LARGE_ARR1
-		arr2 = LARGE_ARR2
-		matmutArgs = MatMutArgs{arr1, arr2, 6}
-	} else {
-		arr1 = []float64{1, 2, 3, 4}
-		arr2 = []float64{5, 6, 7, 8}
-		matmutArgs = MatMutArgs{arr1, arr2, 2}
+func sendInstrumentationReset(serverAddr string) {
+	conn, err := net.Dial("tcp", serverAddr)
+	if err != nil {
+		log.Fatal("Dialing:", err)
 	}
+	defer conn.Close()
 
-	call := client.Go("MatrixMultiply.MultiplyMatrix", matmutArgs, &matReply, nil)
+	client := jsonrpc.NewClient(conn)
+	defer client.Close()
 
-	<-call.Done // wait for response
-	return call.Error
+	var reply EventCounts
+	err = client.Call("Instrumentation.Reset", InstrumentationArgs{}, &reply)
+	if err != nil {
+		log.Fatal("Instrumentation Reset error: ", err)
+	}
+	log.Printf("Instrumentation logs reset at: %d, earlier events drained to %s on the server:\n", reply.Since, reply.Dir)
+	for file, n := range reply.Counts {
+		log.Printf("\t%s: %d\n", file, n)
+	}
 }
 
-func sendZlibCompressLoadTest(cfg LoadConfig, stateSeed int64) error {
-	conn, err := net.Dial("tcp", cfg.Address)
+func sendInstrumentationCounts(serverAddr string) {
+	conn, err := net.Dial("tcp", serverAddr)
 	if err != nil {
-		return err
+		log.Fatal("Dialing:", err)
 	}
 	defer conn.Close()
 
 	client := jsonrpc.NewClient(conn)
+	defer client.Close()
 
-	randGen := rand.New(rand.NewSource(stateSeed))
-	choice := randGen.Intn(100 - (0 + 1)) // rand int between 0 and 100
-
-	var compResp []byte
-	var compArgs ZlibArgs
+	var reply EventCounts
+	err = client.Call("Instrumentation.Counts", InstrumentationArgs{}, &reply)
+	if err != nil {
+		log.Fatal("Instrumentation Counts error: ", err)
+	}
+	log.Printf("Instrumentation events since %d:\n", reply.Since)
+	if reply.DumpedAt == 0 {
+		log.Println("\t(the runtime logs have not been dumped since the reset, their counts are 0 until -idump)")
+	}
+	for file, n := range reply.Counts {
+		log.Printf("\t%s: %d\n", file, n)
+	}
+}
 
-	if choice < cfg.HeavyMix {
-		compArgs = ZlibArgs{[]byte(LARGE_TEXT), len(LARGE_TEXT)}
-	} else {
-		compArgs = ZlibArgs{[]byte("I am crushed and reborn!"), 24}
+// sendExperimentBegin asks the server to start a named timeframe using its own clock
+func sendExperimentBegin(serverAddr string, label string) {
+	conn, err := net.Dial("tcp", serverAddr)
+	if err != nil {
+		log.Fatal("Dialing:", err)
 	}
+	defer conn.Close()
 
-	call := client.Go("Zlib.ZlibCompress", compArgs, &compResp, nil)
+	client := jsonrpc.NewClient(conn)
+	defer client.Close()
 
-	<-call.Done // wait for response
-	return call.Error
+	var reply int64
+	err = client.Call("Experiment.Begin", ExperimentArgs{label}, &reply)
+	if err != nil {
+		log.Fatal("Experiment Begin error: ", err)
+	}
+	log.Printf("Timeframe %q began on the server at: %d\n", label, reply)
 }
 
-func sendArraySortLoadTest(cfg LoadConfig, stateSeed int64) error {
-	conn, err := net.Dial("tcp", cfg.Address)
+// sendExperimentEnd asks the server to finish a named timeframe using its own clock
+func sendExperimentEnd(serverAddr string, label string) {
+	conn, err := net.Dial("tcp", serverAddr)
 	if err != nil {
-		return err
+		log.Fatal("Dialing:", err)
 	}
 	defer conn.Close()
 
 	client := jsonrpc.NewClient(conn)
+	defer client.Close()
 
-	randGen := rand.New(rand.NewSource(stateSeed))
-	choice := randGen.Intn(100 - (0 + 1)) // rand int between 0 and 100
-
-	var sortData, sortReply []int32
+	var reply int64
+	err = client.Call("Experiment.End", ExperimentArgs{label}, &reply)
+	if err != nil {
+		log.Fatal("Experiment End error: ", err)
+	}
+	log.Printf("Timeframe %q ended on the server at: %d\n", label, reply)
+}
 
-	if choice < cfg.HeavyMix {
-		sortData = LARGE_ARR300
-	} else {
-		sortData = []int32{1, 5, 9, 27, 3, 5, 8, 1, 9, 7, 11}
+// readServerClock asks the server for its clock and returns it with the local time it was read at,
+// the middle of the round trip
+func readServerClock(serverAddr string) (time.Time, int64, error) {
+	conn, err := net.Dial("tcp", serverAddr)
+	if err != nil {
+		return time.Time{}, 0, err
 	}
+	defer conn.Close()
 
-	sargs := SortArgs{sortData, len(sortData)}
-	call := client.Go("ArraySort.SortArray", sargs, &sortReply, nil)
+	client := jsonrpc.NewClient(conn)
+	defer client.Close()
 
-	<-call.Done // wait for response
-	return call.Error
+	var reply int64
+	sent := time.Now()
+	err = client.Call("Experiment.Now", ExperimentArgs{}, &reply)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return sent.Add(time.Since(sent) / 2), reply, nil
 }
 
-func sendShutdown(serverAddr string, msg string) {
-	// Connect to the server
+// sendProfile asks the server to record a trace (Profile.Trace) or pprof profiles (Profile.Capture)
+// into its run directory, the call returns once the files have been written
+func sendProfile(serverAddr string, method string, seconds int, label string) {
 	conn, err := net.Dial("tcp", serverAddr)
 	if err != nil {
 		log.Fatal("Dialing:", err)
 	}
 	defer conn.Close()
 
-	// Create JSON-RPC client
 	client := jsonrpc.NewClient(conn)
 	defer client.Close()
 
-	// Get Hash
-	var reply string
-	sargs := ShutdownArgs{msg}
-	err = client.Call("Shutdown.Exit", sargs, &reply)
+	log.Printf("Recording on the server for %d seconds...\n", seconds)
+	var reply ProfileFiles
+	err = client.Call(method, ProfileArgs{seconds, label}, &reply)
 	if err != nil {
-		log.Fatal("Hash Compute error: ", err)
+		log.Fatal("Profile error: ", err)
+	}
+	for _, f := range reply.Files {
+		log.Println("Server wrote:", f)
 	}
-	log.Printf("Shutdown Response: %s\n", reply)
 }
 
 /*
@@ -302,103 +336,37 @@ func sendAsync(serverAddr string, seed int64) {
 	wg.Wait()
 }
 
+// loadTest builds the whole request schedule from cfg before sending anything,
+// so the same seed always sends the same requests at the same offsets
 func loadTest(cfg LoadConfig) []Result {
-	results := make([]Result, 0, cfg.Rate*int(cfg.Duration.Seconds())) // hold all the latencies, array of size 0 with space to hold rate * second entries
-	resultsMu := sync.Mutex{}                                          // mutex to make sure adding to the results array is safe
-
-	var wg sync.WaitGroup
-	interval := time.Second / time.Duration(cfg.Rate)
-	endTime := time.Now().Add(cfg.Duration)
-	ticker := time.NewTicker(interval)
-
-	randGen := rand.New(rand.NewSource(cfg.Seed))
-	var thread int64 = 0
-
-	var upper, lower int
-	switch cfg.Mode {
-	case 0:
-		upper = 100
-		lower = 0
-	case 1: //Hasing only
-		upper = 24
-		lower = 0
-	case 2: // Matrix multiplication only
-		upper = 49
-		lower = 25
-	case 3: // Zlib Compression only
-		upper = 74
-		lower = 50
-	default: // Array sort only
-		upper = 100
-		lower = 75
+	entries, err := buildSchedule(cfg)
+	if err != nil {
+		log.Fatal("Unable to build the request schedule: ", err)
 	}
-
-	log.Printf("Starting Load test with Parameters: %v\n", cfg)
-
-	for time.Now().Before(endTime) {
-		<-ticker.C
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			choice := randGen.Intn(upper-lower) + lower // rand int between 0 and 100
-			if choice < 25 {
-				start := time.Now() // start timeing
-				err := sendHashLoadTest(cfg, thread)
-				lat := time.Since(start) // finish timing to calculate the latency
-				resultsMu.Lock()
-				thread++
-				results = append(results, Result{Latency: lat, Error: err}) //err})
-				resultsMu.Unlock()
-			} else if choice < 50 {
-				start := time.Now() // start timeing
-				err := sendMatMuxLoadTest(cfg, thread)
-				lat := time.Since(start) // finish timing to calculate the latency
-				resultsMu.Lock()
-				thread++
-				results = append(results, Result{Latency: lat, Error: err}) //err})
-				resultsMu.Unlock()
-			} else if choice < 75 {
-				start := time.Now() // start timeing
-				err := sendZlibCompressLoadTest(cfg, thread)
-				lat := time.Since(start) // finish timing to calculate the latency
-				resultsMu.Lock()
-				thread++
-				results = append(results, Result{Latency: lat, Error: err}) //err})
-				resultsMu.Unlock()
-			} else {
-				start := time.Now() // start timeing
-				err := sendArraySortLoadTest(cfg, thread)
-				lat := time.Since(start) // finish timing to calculate the latency
-				resultsMu.Lock()
-				thread++
-				results = append(results, Result{Latency: lat, Error: err}) //err})
-				resultsMu.Unlock()
-			}
-		}()
+	if cfg.ScheduleFile != "" {
+		err = writeSchedule(entries, cfg.ScheduleFile)
+		if err != nil {
+			log.Fatal("Unable to write the request schedule: ", err)
+		}
+		log.Println("Request schedule written to:", cfg.ScheduleFile)
 	}
 
-	ticker.Stop()
-	wg.Wait()
-
+	log.Printf("Starting Load test with Parameters: %v\n", cfg)
+	results := runSchedule(cfg, entries)
 	log.Println("Finished Load Test")
 	return results
 }
 
-func percentiles(results []Result) (p50, p95, p99 float64) {
-	var latencies []float64
+// histograms records the latency and corrected response time of each successful result
+func histograms(results []Result) (latency *Histogram, corrected *Histogram) {
+	latency, corrected = newHistogram(), newHistogram()
 	for _, r := range results {
 		if r.Error == nil {
-			latencies = append(latencies, float64(r.Latency.Microseconds()))
+			latency.record(r.Latency)
+			corrected.record(r.Corrected)
 		}
 	}
-	if len(latencies) == 0 {
-		return math.NaN(), math.NaN(), math.NaN()
-	}
-	sort.Float64s(latencies)
-	p50 = selectPercentile(latencies, 0.50) / 1000
-	p95 = selectPercentile(latencies, 0.95) / 1000
-	p99 = selectPercentile(latencies, 0.99) / 1000
-	return p50, p95, p99
+	return latency, corrected
 }
 
 func selectPercentile(data []float64, pct float64) float64 {
@@ -409,75 +377,273 @@ func selectPercentile(data []float64, pct float64) float64 {
 	return data[idx]
 }
 
-func report(results []Result, cfg LoadConfig) Summary {
-	var latencies []float64
+// modeName is how a -lt mode is named in summaries
+func modeName(mode int) string {
+	switch mode {
+	case 0:
+		return "Mixed Operations"
+	case 1:
+		return "String Hashing"
+	case 2:
+		return "Matrix Multiplication"
+	case 3:
+		return "Zlib Compression"
+	default:
+		return "Array Sort"
+	}
+}
+
+// testName is how a load test is named in summaries, a weighted mix is named after its weights
+func testName(cfg LoadConfig) string {
+	if cfg.Mix != "" {
+		return fmt.Sprintf("Weighted Mix (%s)", cfg.Mix)
+	}
+	return modeName(cfg.Mode)
+}
+
+// summarize collapses results into one Summary line called operation
+func summarize(results []Result, cfg LoadConfig, operation string, rate int) Summary {
+	var sum time.Duration
 	var errors int
+	classes := make(map[string]int)
+	opErrors := make(map[string]map[string]int)
 	for _, r := range results {
 		if r.Error != nil {
 			errors++
+			class := errorClass(r.Error)
+			classes[class]++
+			if opErrors[r.Op] == nil {
+				opErrors[r.Op] = make(map[string]int)
+			}
+			opErrors[r.Op][class]++
 			continue
 		}
-		latencies = append(latencies, float64(r.Latency.Microseconds())/1000.0)
+		sum += r.Latency
 	}
-	sort.Float64s(latencies)
 
-	sum := 0.0
-	for _, v := range latencies {
-		sum += v
-	}
-	avg := sum / float64(len(latencies))
-	throughput := float64(len(latencies)) / cfg.Duration.Seconds() //float64(cfg.Duration) //
-
-	var op string
-	switch cfg.Mode {
-	case 0:
-		op = "Mixed Operations"
-	case 1:
-		op = "String Hashing"
-	case 2:
-		op = "Matrix Multiplication"
-	case 3:
-		op = "Zlib Compression"
-	default:
-		op = "Array Sort"
-	}
-
-	p50, p95, p99 := percentiles(results)
+	latency, corrected := histograms(results)
+	avg := float64(sum) / float64(time.Millisecond) / float64(latency.count())
+	throughput := float64(latency.count()) / cfg.Duration.Seconds() //float64(cfg.Duration) //
 
 	summary := Summary{
-		Operation:  op,
+		Operation:  operation,
 		Seed:       cfg.Seed,
-		Rate:       cfg.Rate,
+		Rate:       rate,
 		AvgLatency: avg,
-		P50Latency: p50,
-		P95Latency: p95,
-		P99Latency: p99,
+		P50Latency: latency.quantileMs(0.50),
+		P95Latency: latency.quantileMs(0.95),
+		P99Latency: latency.quantileMs(0.99),
 		Throughput: throughput,
 		Errors:     errors,
+
+		ErrorClasses: classes,
+		OpErrors:     opErrors,
+
+		P999Latency:  latency.quantileMs(0.999),
+		P9999Latency: latency.quantileMs(0.9999),
+		LatencyHist:  latency,
+
+		CorrectedP50:  corrected.quantileMs(0.50),
+		CorrectedP95:  corrected.quantileMs(0.95),
+		CorrectedP99:  corrected.quantileMs(0.99),
+		CorrectedHist: corrected,
+
+		Connections: string(cfg.Connections),
+	}
+	if schedule, err := newArrivals(cfg); err == nil {
+		summary.Arrival = schedule.label()
+	}
+	summary.Profile = cfg.Profile.String()
+	summary.Trace = cfg.Trace
+	summary.Speedup = cfg.Speedup
+	summary.Warmup = cfg.Warmup.Seconds()
+	summary.Cooldown = cfg.Cooldown.Seconds()
+	summary.Mix = cfg.Mix
+	summary.Duration = cfg.Duration.Seconds()
+	summary.Achieved = achieved(results, cfg)
+	if len(cfg.Sizes) > 0 {
+		summary.Sizes = cfg.Sizes.String()
+		summary.MeanSize = meanSize(results)
+	}
+	if cfg.Connections == "" {
+		summary.Connections = string(ConnPerRequest)
+	} else if cfg.Connections == ConnPool {
+		summary.Connections = fmt.Sprintf("%s:%d", ConnPool, cfg.PoolSize)
+	}
+	return summary
+}
+
+// achieved is the replies per second that arrived before the steady window ended
+func achieved(results []Result, cfg LoadConfig) float64 {
+	speedup := cfg.Speedup
+	if speedup == 0 {
+		speedup = 1
+	}
+	end := cfg.Warmup + time.Duration(float64(cfg.Duration)/speedup)
+
+	onTime := 0
+	for _, r := range results {
+		if r.Error == nil && r.Done <= end {
+			onTime++
+		}
+	}
+	return float64(onTime) / cfg.Duration.Seconds()
+}
+
+// report appends the test's Summary to cfg.ResultFile. When the test sent more than one operation
+// a Summary per operation follows it, all of them share the test's TestID.
+// Requests scheduled in the warmup or cooldown are only written to the request records.
+func report(all []Result, cfg LoadConfig) Summary {
+	results := steadyResults(all, cfg)
+
+	op := testName(cfg)
+	if cfg.Trace != "" {
+		op = "Trace Replay"
+	}
+
+	rate := cfg.Rate
+	if cfg.Profile.Shape != "" || cfg.Trace != "" {
+		// a profile or trace has no single rate, record the average that was offered
+		rate = int(math.Round(float64(len(results)) / cfg.Duration.Seconds()))
+	}
+
+	testStart := time.Now()
+	if len(all) > 0 {
+		testStart = all[0].TestStart
 	}
+
+	summary := summarize(results, cfg, op, rate)
+	summary.TestID = testStart.Format("20060102-150405.000000")
 	log.Printf("Load Test Summary Results: %v\n", summary)
+	summaries := []Summary{summary}
+
+	byOp := make(map[string][]Result)
+	for _, r := range results {
+		byOp[r.Op] = append(byOp[r.Op], r)
+	}
+	if len(byOp) > 1 {
+		for _, o := range []string{OpHash, OpMatMul, OpZlib, OpSort} {
+			if len(byOp[o]) == 0 {
+				continue
+			}
+			// the rate stays the test's offered rate so the per operation lines sit under the aggregate
+			s := summarize(byOp[o], cfg, fmt.Sprintf("%s (%s)", op, opNames[o]), rate)
+			s.Op = o
+			s.TestID = summary.TestID
+			log.Printf("%s Summary Results: %v\n", opNames[o], s)
+			summaries = append(summaries, s)
+		}
+	}
 
 	f, err := os.OpenFile(cfg.ResultFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644) // 0644 gives read and write permisisons
 	if err != nil {
 		log.Println("Unable to open file to write summary record")
 		log.Fatal(err)
 	}
-	err = json.NewEncoder(f).Encode(summary)
-	if err != nil {
-		log.Println("Summary contained NaN due to low performance, cannot write this record")
+	for _, s := range summaries {
+		err = json.NewEncoder(f).Encode(s)
+		if err != nil {
+			log.Printf("%s summary contained NaN due to low performance, cannot write this record\n", s.Operation)
+		}
 	}
 	f.Close()
 
+	path, err := writeRequestRecords(all, summary, cfg)
+	if err != nil {
+		log.Fatal("Unable to write the request records: ", err)
+	}
+	log.Println("Request records written to:", path)
+
+	if cfg.Profile.Shape != "" {
+		path, err := writeRateSamples(rateSamples(results, cfg, op), cfg.ResultFile)
+		if err != nil {
+			log.Fatal("Unable to write the offered and achieved rates: ", err)
+		}
+		log.Println("Offered and achieved rate per second written to:", path)
+	}
+
 	return summary
 }
 
+// parseLoadOptions applies the optional arguments after -lt's result file,
+// each one is a connection strategy, an arrival process, a rate profile, an operation mix, payload sizes or a schedule file
+func parseLoadOptions(cfg *LoadConfig, opts []string) error {
+	var err error
+	for _, opt := range opts {
+		name, _, _ := strings.Cut(opt, ":")
+		switch name {
+		case string(ConnPerRequest), string(ConnPool), string(ConnMultiplex):
+			cfg.Connections, cfg.PoolSize, err = parseConnStrategy(opt)
+		case string(ArrivalFixed), string(ArrivalPoisson), string(ArrivalPareto), string(ArrivalLognormal):
+			cfg.Arrival, cfg.ArrivalShape, err = parseArrival(opt)
+		case string(ProfileRamp), string(ProfileStep), string(ProfileSpike), string(ProfileSine):
+			cfg.Profile, err = parseRateProfile(opt)
+		case "mix":
+			cfg.Mix = strings.TrimPrefix(opt, "mix:")
+			_, err = parseOpMix(cfg.Mix)
+		case "size":
+			cfg.Sizes, err = parsePayloadSizes(strings.TrimPrefix(opt, "size:"))
+		case "schedule":
+			cfg.ScheduleFile = strings.TrimPrefix(opt, "schedule:")
+			if cfg.ScheduleFile == "" || cfg.ScheduleFile == opt {
+				err = fmt.Errorf("schedule needs a file, e.g. schedule:run1.jsonl")
+			}
+		case "warmup", "cooldown":
+			var d time.Duration
+			d, err = time.ParseDuration(strings.TrimPrefix(opt, name+":"))
+			if err == nil && d < 0 {
+				err = fmt.Errorf("%s must not be negative", name)
+			}
+			if name == "warmup" {
+				cfg.Warmup = d
+			} else {
+				cfg.Cooldown = d
+			}
+		case "timeframe":
+			cfg.Timeframe = strings.TrimPrefix(opt, "timeframe:")
+			if cfg.Timeframe == "" || cfg.Timeframe == opt {
+				err = fmt.Errorf("timeframe needs a label, e.g. timeframe:steady")
+			}
+		case "timeout":
+			cfg.Timeout, err = time.ParseDuration(strings.TrimPrefix(opt, "timeout:"))
+			if err == nil && cfg.Timeout <= 0 {
+				err = fmt.Errorf("timeout must be positive, e.g. timeout:500ms")
+			}
+		default:
+			err = fmt.Errorf("unknown load test option %q", opt)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func help() {
 	fmt.Println(helpMessage)
 }
 
+// leading -out <directory> and -run <run-id> options apply to every command,
+// they are removed so the command is always at os.Args[1]
+func parseOutputOptions(args []string) []string {
+	for len(args) > 2 {
+		switch args[1] {
+		case "-out":
+			outputRoot = args[2]
+		case "-run":
+			runID = args[2]
+		default:
+			return args
+		}
+		args = append(args[:1:1], args[3:]...)
+	}
+	return args
+}
+
 // Usage: ./main -a (for async)
 // -lt for load test
 func main() {
+	os.Args = parseOutputOptions(os.Args)
 	argsLen := len(os.Args)
 	if argsLen > 1 {
 		switch os.Args[1] {
@@ -502,7 +668,7 @@ func main() {
 				help()
 			}
 		case "-lt":
-			if argsLen == 9 {
+			if argsLen >= 9 {
 
 				rate, err := strconv.Atoi(os.Args[3])
 				if err != nil {
@@ -538,163 +704,150 @@ func main() {
 					return
 				}
 
-				config := LoadConfig{os.Args[2], rate, time.Duration(durr) * time.Second, seed, mode, heavyMix, os.Args[8] + ".jsonl"}
+				config := LoadConfig{Address: os.Args[2], Rate: rate, Duration: time.Duration(durr) * time.Second, Seed: seed, Mode: mode, HeavyMix: heavyMix, ResultFile: os.Args[8] + ".jsonl"}
+				err = parseLoadOptions(&config, os.Args[9:])
+				if err != nil {
+					log.Println(err)
+					help()
+					return
+				}
 				report(loadTest(config), config)
 			} else {
 				help()
 			}
-		case "-lt1":
-			var config LoadConfig
-			if len(os.Args) == 3 {
-				log.Println("Processing Load Test, please wait 1 minute!")
-				for i := 1; i < 21; i++ {
-					config = LoadConfig{os.Args[2], 100 * i, time.Duration(1) * time.Second, 1, 0, 0, "load_test_eg1.jsonl"}
-					report(loadTest(config), config)
-					config = LoadConfig{os.Args[2], 100 * i, time.Duration(1) * time.Second, 1, 1, 0, "load_test_eg1.jsonl"}
-					report(loadTest(config), config)
-					config = LoadConfig{os.Args[2], 100 * i, time.Duration(1) * time.Second, 1, 2, 0, "load_test_eg1.jsonl"}
-					report(loadTest(config), config)
-					config = LoadConfig{os.Args[2], 100 * i, time.Duration(1) * time.Second, 1, 3, 0, "load_test_eg1.jsonl"}
-					report(loadTest(config), config)
-					config = LoadConfig{os.Args[2], 100 * i, time.Duration(1) * time.Second, 1, 4, 0, "load_test_eg1.jsonl"}
-					report(loadTest(config), config)
-				}
-				sendShutdown(os.Args[2], "")
-				log.Println("Finished Processing test, Results in load_test_eg1.jsonl")
-			}
-		case "-lt2":
-			// "localhost:1234"
-			var config LoadConfig
-			if len(os.Args) == 3 {
-				log.Println("Processing Load Test, please wait 1 minute!")
-				for i := 1; i < 10; i++ {
-					config = LoadConfig{os.Args[2], 300 + (100 * i), time.Duration(1) * time.Second, 1, 0, 0, "load_test_eg2.jsonl"}
-					report(loadTest(config), config)
-					config = LoadConfig{os.Args[2], 300 + (100 * i), time.Duration(1) * time.Second, 1, 1, 0, "load_test_eg2.jsonl"}
-					report(loadTest(config), config)
-					config = LoadConfig{os.Args[2], 300 + (100 * i), time.Duration(1) * time.Second, 1, 2, 0, "load_test_eg2.jsonl"}
-					report(loadTest(config), config)
-					config = LoadConfig{os.Args[2], 300 + (100 * i), time.Duration(1) * time.Second, 1, 3, 0, "load_test_eg2.jsonl"}
-					report(loadTest(config), config)
-					config = LoadConfig{os.Args[2], 300 + (100 * i), time.Duration(1) * time.Second, 1, 4, 0, "load_test_eg2.jsonl"}
-					report(loadTest(config), config)
-				}
-				sendShutdown(os.Args[2], "")
-				log.Println("Finished Processing test, Results in load_test_eg2.jsonl")
-			}
-		case "-lt3":
-			var config LoadConfig
-			if len(os.Args) == 3 {
-				log.Println("Processing Load Test, please wait 1 minute!")
-				for i := 1; i < 10; i++ {
-					config = LoadConfig{os.Args[2], 300 + (100 * i), time.Duration(1) * time.Second, 1, 0, 50, "load_test_eg3.jsonl"}
-					report(loadTest(config), config)
-					config = LoadConfig{os.Args[2], 300 + (100 * i), time.Duration(1) * time.Second, 1, 1, 50, "load_test_eg3.jsonl"}
-					report(loadTest(config), config)
-					config = LoadConfig{os.Args[2], 300 + (100 * i), time.Duration(1) * time.Second, 1, 2, 50, "load_test_eg3.jsonl"}
-					report(loadTest(config), config)
-					config = LoadConfig{os.Args[2], 300 + (100 * i), time.Duration(1) * time.Second, 1, 3, 50, "load_test_eg3.jsonl"}
-					report(loadTest(config), config)
-					config = LoadConfig{os.Args[2], 300 + (100 * i), time.Duration(1) * time.Second, 1, 4, 50, "load_test_eg3.jsonl"}
-					report(loadTest(config), config)
-				}
-				sendShutdown(os.Args[2], "")
-				log.Println("Finished Processing test, Results in load_test_eg3.jsonl")
-			}
-		case "-lt4":
-			var config LoadConfig
-			if len(os.Args) == 3 {
-				log.Println("Processing Load Test, please wait 1 minute!")
-				for i := 1; i < 10; i++ {
-					config = LoadConfig{os.Args[2], 300 + (100 * i), time.Duration(1) * time.Second, 1, 0, 100, "load_test_eg4.jsonl"}
-					report(loadTest(config), config)
-					config = LoadConfig{os.Args[2], 300 + (100 * i), time.Duration(1) * time.Second, 1, 1, 100, "load_test_eg4.jsonl"}
-					report(loadTest(config), config)
-					config = LoadConfig{os.Args[2], 300 + (100 * i), time.Duration(1) * time.Second, 1, 2, 100, "load_test_eg4.jsonl"}
-					report(loadTest(config), config)
-					config = LoadConfig{os.Args[2], 300 + (100 * i), time.Duration(1) * time.Second, 1, 3, 100, "load_test_eg4.jsonl"}
-					report(loadTest(config), config)
-					config = LoadConfig{os.Args[2], 300 + (100 * i), time.Duration(1) * time.Second, 1, 4, 100, "load_test_eg4.jsonl"}
-					report(loadTest(config), config)
-				}
-				sendShutdown(os.Args[2], "")
-				log.Println("Finished Processing test, Results in load_test_eg4.jsonl")
-			}
-		case "-expr1":
-			// Run a mixed operation test that is suitable for instrumentation readings
-			var config LoadConfig
-			if len(os.Args) == 3 {
-				log.Println("Processing Load Test, please wait 1 minute!")
-				config = LoadConfig{os.Args[2], 20, time.Duration(10) * time.Second, 1, 0, 50, ""}
-				start := instrumentation_export.NanotimeNow()
-				loadTest(config)
-				end := instrumentation_export.NanotimeNow()
-				sendShutdown(os.Args[2], "Test Type: Mixed workloads for 10 seconds, 20 requests per second, 50% Heavy Mix, seed: 1")
-				log.Println("Finished Processing test, Results in json_results")
+		case "-slo":
+			if argsLen >= 10 {
+				pct, err := strconv.ParseFloat(strings.TrimPrefix(os.Args[3], "p"), 64)
+				if err != nil || pct <= 0 || pct >= 100 {
+					log.Println("The percentile must be between 0 and 100, e.g. 99 or 99.9")
+					help()
+					return
+				}
+				slo, err := strconv.ParseFloat(os.Args[4], 64)
+				if err != nil || slo <= 0 {
+					log.Println("The SLO must be a positive number of milliseconds")
+					help()
+					return
+				}
+				durr, err := strconv.Atoi(os.Args[5])
+				if err != nil {
+					help()
+					return
+				}
+				seed, err := strconv.ParseInt(os.Args[6], 10, 64)
+				if err != nil {
+					help()
+					return
+				}
+				mode, err := strconv.Atoi(os.Args[7])
+				if err != nil || mode < 0 || mode > 4 {
+					help()
+					return
+				}
+				heavyMix, err := strconv.Atoi(os.Args[8])
+				if err != nil || heavyMix > 100 {
+					help()
+					return
+				}
 
-				tf := Timeframe{
-					Start: start,
-					End:   end,
+				config := LoadConfig{Address: os.Args[2], Duration: time.Duration(durr) * time.Second, Seed: seed, Mode: mode, HeavyMix: heavyMix, ResultFile: os.Args[9] + ".jsonl"}
+				search := SLOSearch{Percentile: pct / 100, SLO: slo, Start: sloDefaultStart, Max: sloDefaultMax, Repeats: sloDefaultRepeat}
+				opts, err := parseSLOOptions(&search, os.Args[10:])
+				if err == nil {
+					err = parseLoadOptions(&config, opts)
+				}
+				if err == nil {
+					err = search.validate(config)
+				}
+				if err != nil {
+					log.Println(err)
+					help()
+					return
+				}
+				if search.Repeats > sloMaxRepeat {
+					search.Repeats = sloMaxRepeat
 				}
 
-				logTimeframe(tf)
+				res := search.run(config)
+				if res.MaxRate == 0 {
+					log.Printf("Even %d req/s misses the SLO, try a lower start:<rate>\n", search.Start)
+				} else if res.Limited {
+					log.Printf("The SLO holds up to the search limit of %d req/s, raise it with max:<rate>\n", res.MaxRate)
+				} else {
+					log.Printf("Highest rate within the SLO: %d req/s (p%v under %vms)\n", res.MaxRate, res.Percentile, res.SLO)
+				}
+				path, err := writeSLOResult(res, config.ResultFile)
+				if err != nil {
+					log.Fatal("Unable to write the search result: ", err)
+				}
+				log.Println("Search written to:", path)
+			} else {
+				help()
 			}
-		case "-expr2":
-			// Run a mixed operation test that is suitable for instrumentation readings
-			var config LoadConfig
-			if len(os.Args) == 3 {
-				log.Println("Processing Load Test, please wait 1 minute!")
-				config = LoadConfig{os.Args[2], 20, time.Duration(10) * time.Second, 1, 1, 50, ""}
-				start := instrumentation_export.NanotimeNow()
-				loadTest(config)
-				end := instrumentation_export.NanotimeNow()
-				sendShutdown(os.Args[2], "Test Type: String Hashing (CPU Bound) workload for 10 seconds, 20 requests per second, 50% Heavy Mix, seed: 1")
-				log.Println("Finished Processing test, Results in json_results")
-
-				tf := Timeframe{
-					Start: start,
-					End:   end,
+		case "-replay":
+			if argsLen >= 5 {
+				config := LoadConfig{Address: os.Args[2], Trace: os.Args[3], Speedup: 1, ResultFile: os.Args[4] + ".jsonl"}
+				opts := os.Args[5:]
+				if len(opts) > 0 {
+					if speedup, err := strconv.ParseFloat(opts[0], 64); err == nil {
+						if speedup <= 0 {
+							log.Println("The speed up must be positive")
+							help()
+							return
+						}
+						config.Speedup = speedup
+						opts = opts[1:]
+					}
+				}
+				for _, opt := range opts {
+					// a trace fixes its own arrivals, only the connections and deadline can be chosen
+					name, _, _ := strings.Cut(opt, ":")
+					var err error
+					switch name {
+					case string(ConnPerRequest), string(ConnPool), string(ConnMultiplex), "timeout":
+						err = parseLoadOptions(&config, []string{opt})
+					default:
+						err = fmt.Errorf("unexpected argument %q", opt)
+					}
+					if err != nil {
+						log.Println(err)
+						help()
+						return
+					}
 				}
 
-				logTimeframe(tf)
+				entries, err := readArrivalTrace(config.Trace)
+				if err != nil {
+					log.Fatal("Unable to read the arrival trace: ", err)
+				}
+				config.Duration = replayDuration(entries, config)
+				log.Printf("Replaying %d requests from %s at %vx speed\n", len(entries), config.Trace, config.Speedup)
+				results := runSchedule(config, entries)
+				log.Println("Finished Replay")
+				report(results, config)
+			} else {
+				help()
 			}
-		case "-expr3":
-			// Run a mixed operation test that is suitable for instrumentation readings
-			var config LoadConfig
-			if len(os.Args) == 3 {
-				log.Println("Processing Load Test, please wait 1 minute!")
-				config = LoadConfig{os.Args[2], 20, time.Duration(10) * time.Second, 1, 2, 50, ""}
-				start := instrumentation_export.NanotimeNow()
-				loadTest(config)
-				end := instrumentation_export.NanotimeNow()
-				sendShutdown(os.Args[2], "Test Type: Matrix Multiplication (Compute Bound) workload for 10 seconds, 20 requests per second, 50% Heavy Mix, seed: 1")
-				log.Println("Finished Processing test, Results in json_results")
-
-				tf := Timeframe{
-					Start: start,
-					End:   end,
+		case "-spec":
+			if len(os.Args) == 4 {
+				spec, err := readSpec(os.Args[3])
+				if err != nil {
+					log.Fatal("Unable to read the spec: ", err)
 				}
-
-				logTimeframe(tf)
+				runSpec(spec, os.Args[2])
+			} else {
+				help()
 			}
-		case "-expr4":
-			// Run a mixed operation test that is suitable for instrumentation readings
-			var config LoadConfig
+		case "-lt1", "-lt2", "-lt3", "-lt4", "-expr1", "-expr2", "-expr3", "-expr4":
+			// the pre-prepared tests are the specs bundled from specs/
 			if len(os.Args) == 3 {
-				log.Println("Processing Load Test, please wait 1 minute!")
-				config = LoadConfig{os.Args[2], 20, time.Duration(10) * time.Second, 1, 4, 50, ""}
-				start := instrumentation_export.NanotimeNow()
-				loadTest(config)
-				end := instrumentation_export.NanotimeNow()
-				sendShutdown(os.Args[2], "Test Type: Array Sort (Memory Bound) workload for 10 seconds, 20 requests per second, 50% Heavy Mix, seed: 1")
-				log.Println("Finished Processing test, Results in json_results")
-
-				tf := Timeframe{
-					Start: start,
-					End:   end,
+				spec, err := bundledSpec(strings.TrimPrefix(os.Args[1], "-"))
+				if err != nil {
+					log.Fatal(err)
 				}
-
-				logTimeframe(tf)
+				runSpec(spec, os.Args[2])
+			} else {
+				help()
 			}
 		case "-g":
 			if len(os.Args) == 3 {
@@ -702,11 +855,22 @@ func main() {
 				if err != nil {
 					log.Fatalf("failed reading the input file")
 				}
-				makeGraphs(data)
+				makeGraphs(data, nil)
 				if err != nil {
 					log.Fatalf("failed making graphs")
 				}
 			}
+		case "-knee":
+			// find where each operation saturates and circle it on the -g graphs
+			if len(os.Args) == 3 {
+				data, err := getSummaryData(os.Args[2])
+				if err != nil {
+					log.Fatalf("failed reading the input file")
+				}
+				knees := findKnees(data)
+				printKnees(knees)
+				makeGraphs(data, knees)
+			}
 		case "-inst":
 			// create graphs relating to general instrumentation info
 			if len(os.Args) == 3 {
@@ -714,13 +878,11 @@ func main() {
 				if err != nil {
 					log.Fatalf("failed reading the input file")
 				}
-				tfdata, err := getTimeframeData("../json_results/timeframe.jsonl")
+				tfdata, err := getTimeframeData(outputPath("timeframe.jsonl"))
 				if err != nil {
 					log.Fatalf("failed reading the input timeframe file")
 				}
-				makeCreationLatencyHistogram(data, tfdata)
-				makeCreationLatencyCDF(data, tfdata)
-				makeGoroutinesCreated(data, tfdata)
+				analyzeInstrumentation(data, tfdata)
 				if err != nil {
 					log.Fatalf("failed making graphs")
 				}
@@ -739,12 +901,11 @@ func main() {
 				if err != nil {
 					log.Fatalf("failed reading the input file")
 				}
-				tfdata, err := getTimeframeData("../json_results/timeframe.jsonl")
+				tfdata, err := getTimeframeData(outputPath("timeframe.jsonl"))
 				if err != nil {
 					log.Fatalf("failed reading the input timeframe file")
 				}
-				makeSchedulingLatencyCDF(datags, tfdata)
-				makeSchedulingLatencyHistogram(datags, tfdata)
+				analyzeGStatus(datags, tfdata)
 				if err != nil {
 					log.Fatalf("failed making graphs")
 				}
@@ -756,21 +917,90 @@ func main() {
 				if err != nil {
 					log.Fatalf("failed reading the input file")
 				}
-				tfdata, err := getTimeframeData("../json_results/timeframe.jsonl")
+				tfdata, err := getTimeframeData(outputPath("timeframe.jsonl"))
 				if err != nil {
 					log.Fatalf("failed reading the input timeframe file")
 				}
-				makeCycleScatterPlot(datac, tfdata)
-				makeCyclesHistogram(datac, tfdata)
-				makeCyclesCDF(datac, tfdata)
+				analyzeCycles(datac, tfdata)
 				if err != nil {
 					log.Fatalf("failed making graphs")
 				}
 			}
+		case "-rtmetrics":
+			// create graphs from the server's runtime/metrics samples
+			if len(os.Args) == 3 {
+				datarm, err := getRuntimeMetricsData(os.Args[2])
+				if err != nil {
+					log.Fatalf("failed reading the input file")
+				}
+				tfdata, err := getTimeframeData(outputPath("timeframe.jsonl"))
+				if err != nil {
+					log.Fatalf("failed reading the input timeframe file")
+				}
+				makeRuntimeMetricsGraphs(datarm, tfdata)
+			}
+		case "-rates":
+			if len(os.Args) == 3 {
+				data, err := getRateSampleData(os.Args[2])
+				if err != nil {
+					log.Fatalf("failed reading the input file")
+				}
+				makeRateProfileGraphs(data)
+			}
 		case "-pstat":
 			if len(os.Args) == 3 {
 				Dump_perf_stats(os.Args[2])
 			}
+		case "-idump":
+			if argsLen == 4 {
+				sendInstrumentationDump(os.Args[2], os.Args[3], "")
+			} else if argsLen == 5 {
+				sendInstrumentationDump(os.Args[2], os.Args[3], os.Args[4])
+			} else {
+				help()
+			}
+		case "-ireset":
+			if argsLen == 3 {
+				sendInstrumentationReset(os.Args[2])
+			} else {
+				help()
+			}
+		case "-icount":
+			if argsLen == 3 {
+				sendInstrumentationCounts(os.Args[2])
+			} else {
+				help()
+			}
+		case "-begin":
+			if argsLen == 4 {
+				sendExperimentBegin(os.Args[2], os.Args[3])
+			} else {
+				help()
+			}
+		case "-end":
+			if argsLen == 4 {
+				sendExperimentEnd(os.Args[2], os.Args[3])
+			} else {
+				help()
+			}
+		case "-trace", "-profile":
+			method := "Profile.Trace"
+			if os.Args[1] == "-profile" {
+				method = "Profile.Capture"
+			}
+			if argsLen == 4 || argsLen == 5 {
+				seconds, err := strconv.Atoi(os.Args[3])
+				if err != nil {
+					log.Fatal("Seconds must be an integer: ", err)
+				}
+				label := ""
+				if argsLen == 5 {
+					label = os.Args[4]
+				}
+				sendProfile(os.Args[2], method, seconds, label)
+			} else {
+				help()
+			}
 		case "-pg":
 			if len(os.Args) == 3 {
 				data, err := getSummaryData(os.Args[2])
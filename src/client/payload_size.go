@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+/*
+
+	Payload size distributions, the size of every generated payload drawn from the seed so request size can be
+	swept. A size is bytes for hash and zlib, elements for sort and the matrix side N for matmul.
+
+*/
+
+type SizeShape string
+
+const (
+	SizeFixed     SizeShape = "fixed"     // every payload is Small
+	SizeUniform   SizeShape = "uniform"   // evenly spread from Small to Large
+	SizeBimodal   SizeShape = "bimodal"   // Small, except LargeMix percent of the payloads are Large
+	SizeLognormal SizeShape = "lognormal" // heavy tailed with median Small, shape is Sigma of the underlying normal
+)
+
+// the sizes get their own random stream so they do not shift the operation mix picked from cfg.Seed
+const sizeSeedOffset = 0x517e
+
+type SizeDist struct {
+	Shape    SizeShape
+	Small    int     // the fixed size, smallest uniform size, small bimodal size or lognormal median
+	Large    int     // largest uniform size or large bimodal size
+	LargeMix int     // percentage of bimodal payloads that are Large
+	Sigma    float64 // lognormal shape
+}
+
+// PayloadSizes is the size distribution of each operation, the "" entry covers operations without their own
+type PayloadSizes map[string]SizeDist
+
+// forOp returns the distribution op's payloads are drawn from, false when op uses the fixed heavy or light payloads
+func (s PayloadSizes) forOp(op string) (SizeDist, bool) {
+	if d, ok := s[op]; ok {
+		return d, true
+	}
+	d, ok := s[""]
+	return d, ok
+}
+
+// draw returns the size of the next payload, at least 1
+func (d SizeDist) draw(randGen *rand.Rand) int {
+	size := d.Small
+	switch d.Shape {
+	case SizeUniform:
+		size = d.Small + randGen.Intn(d.Large-d.Small+1)
+	case SizeBimodal:
+		if randGen.Intn(100) < d.LargeMix {
+			size = d.Large
+		}
+	case SizeLognormal:
+		size = int(math.Round(float64(d.Small) * math.Exp(d.Sigma*randGen.NormFloat64())))
+	}
+	if size < 1 {
+		return 1
+	}
+	return size
+}
+
+func (d SizeDist) String() string {
+	switch d.Shape {
+	case SizeUniform:
+		return fmt.Sprintf("%s:%d:%d", d.Shape, d.Small, d.Large)
+	case SizeBimodal:
+		return fmt.Sprintf("%s:%d:%d:%d", d.Shape, d.Small, d.Large, d.LargeMix)
+	case SizeLognormal:
+		return fmt.Sprintf("%s:%d:%v", d.Shape, d.Small, d.Sigma)
+	}
+	return fmt.Sprintf("%s:%d", d.Shape, d.Small)
+}
+
+// String is how the sizes are recorded in the Summary, e.g. uniform:100:1000 or lognormal:1000:1,matmul:fixed:32
+func (s PayloadSizes) String() string {
+	var parts []string
+	if d, ok := s[""]; ok {
+		parts = append(parts, d.String())
+	}
+	for _, op := range []string{OpHash, OpMatMul, OpZlib, OpSort} {
+		if d, ok := s[op]; ok {
+			parts = append(parts, op+":"+d.String())
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// parsePayloadSizes reads a comma separated list of [<op>:]<distribution>, where a distribution is fixed:<size>,
+// uniform:<min>:<max>, bimodal:<small>:<large>:<large%> or lognormal:<median>[:<sigma>]
+func parsePayloadSizes(s string) (PayloadSizes, error) {
+	sizes := make(PayloadSizes)
+	for _, part := range strings.Split(s, ",") {
+		op := ""
+		if name, rest, ok := strings.Cut(part, ":"); ok {
+			if _, isOp := opMethods[name]; isOp {
+				op, part = name, rest
+			}
+		}
+		if _, dup := sizes[op]; dup {
+			if op == "" {
+				return nil, fmt.Errorf("sizes has more than one distribution for every operation")
+			}
+			return nil, fmt.Errorf("sizes has more than one distribution for %s", op)
+		}
+		d, err := parseSizeDist(part)
+		if err != nil {
+			return nil, err
+		}
+		sizes[op] = d
+	}
+	return sizes, nil
+}
+
+func parseSizeDist(s string) (SizeDist, error) {
+	parts := strings.Split(s, ":")
+	d := SizeDist{Shape: SizeShape(parts[0]), Sigma: defaultLognormalSigma}
+
+	var want []*int
+	switch d.Shape {
+	case SizeFixed:
+		want = []*int{&d.Small}
+	case SizeUniform, SizeBimodal:
+		want = []*int{&d.Small, &d.Large}
+		if d.Shape == SizeBimodal {
+			want = append(want, &d.LargeMix)
+		}
+	case SizeLognormal:
+		want = []*int{&d.Small}
+		if len(parts) == 3 {
+			v, err := strconv.ParseFloat(parts[2], 64)
+			if err != nil || v < 0 {
+				return d, fmt.Errorf("lognormal sigma must be a number that is not negative, got %q", parts[2])
+			}
+			d.Sigma = v
+			parts = parts[:2]
+		}
+	default:
+		return d, fmt.Errorf("unknown size distribution %q", s)
+	}
+	if len(parts) != 1+len(want) {
+		return d, fmt.Errorf("%s needs %d values, got %q", d.Shape, len(want), s)
+	}
+	for i, v := range want {
+		n, err := strconv.Atoi(parts[i+1])
+		if err != nil {
+			return d, fmt.Errorf("%s values must be whole numbers, got %q", d.Shape, s)
+		}
+		*v = n
+	}
+
+	if d.Small <= 0 || (d.Shape == SizeUniform || d.Shape == SizeBimodal) && d.Large <= 0 {
+		return d, fmt.Errorf("%s sizes must be positive, got %q", d.Shape, s)
+	}
+	if d.Shape == SizeUniform && d.Large < d.Small {
+		return d, fmt.Errorf("uniform needs min <= max, got %q", s)
+	}
+	if d.Shape == SizeBimodal && (d.LargeMix < 0 || d.LargeMix > 100) {
+		return d, fmt.Errorf("bimodal large%% must be 0 to 100, got %d", d.LargeMix)
+	}
+	return d, nil
+}
+
+// meanSize is the average size of the payloads sent, the x axis of a size sweep
+func meanSize(results []Result) float64 {
+	if len(results) == 0 {
+		return 0
+	}
+	var sum int
+	for _, r := range results {
+		sum += r.Size
+	}
+	return float64(sum) / float64(len(results))
+}
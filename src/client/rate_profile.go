@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+
+	Rate profiles, the offered rate of one continuous load test as a function of time
+
+*/
+
+type ProfileShape string
+
+const (
+	ProfileRamp  ProfileShape = "ramp"  // linear from Low to High over the whole test
+	ProfileStep  ProfileShape = "step"  // Low until At, High afterwards
+	ProfileSpike ProfileShape = "spike" // Low, except High for Length starting at At
+	ProfileSine  ProfileShape = "sine"  // swings between Low and High once every Period, starting halfway up
+)
+
+type RateProfile struct {
+	Shape  ProfileShape
+	Low    float64       // requests per second
+	High   float64       // requests per second
+	At     time.Duration // when a step or spike starts
+	Length time.Duration // how long a spike lasts
+	Period time.Duration // length of one sine wave
+}
+
+// rate returns the offered rate elapsed into a test that lasts total
+func (p RateProfile) rate(elapsed time.Duration, total time.Duration) float64 {
+	switch p.Shape {
+	case ProfileRamp:
+		frac := math.Min(float64(elapsed)/float64(total), 1)
+		return p.Low + (p.High-p.Low)*frac
+	case ProfileStep:
+		if elapsed < p.At {
+			return p.Low
+		}
+		return p.High
+	case ProfileSpike:
+		if elapsed >= p.At && elapsed < p.At+p.Length {
+			return p.High
+		}
+		return p.Low
+	case ProfileSine:
+		mid, amp := (p.High+p.Low)/2, (p.High-p.Low)/2
+		return mid + amp*math.Sin(2*math.Pi*float64(elapsed)/float64(p.Period))
+	}
+	return p.Low
+}
+
+func (p RateProfile) validate() error {
+	if p.Low <= 0 || p.High <= 0 {
+		return fmt.Errorf("%s rates must be positive", p.Shape)
+	}
+	switch p.Shape {
+	case ProfileRamp:
+	case ProfileStep:
+		if p.At < 0 {
+			return fmt.Errorf("step time must not be negative")
+		}
+	case ProfileSpike:
+		if p.At < 0 || p.Length <= 0 {
+			return fmt.Errorf("spike needs a start that is not negative and a positive length")
+		}
+	case ProfileSine:
+		if p.Period <= 0 {
+			return fmt.Errorf("sine needs a positive period")
+		}
+	default:
+		return fmt.Errorf("unknown rate profile %q", p.Shape)
+	}
+	return nil
+}
+
+// String is how the profile is recorded in the Summary, the same format parseRateProfile reads
+func (p RateProfile) String() string {
+	switch p.Shape {
+	case ProfileRamp:
+		return fmt.Sprintf("%s:%v:%v", p.Shape, p.Low, p.High)
+	case ProfileStep:
+		return fmt.Sprintf("%s:%v:%v:%v", p.Shape, p.Low, p.High, p.At)
+	case ProfileSpike:
+		return fmt.Sprintf("%s:%v:%v:%v:%v", p.Shape, p.Low, p.High, p.At, p.Length)
+	case ProfileSine:
+		return fmt.Sprintf("%s:%v:%v:%v", p.Shape, p.Low, p.High, p.Period)
+	}
+	return ""
+}
+
+// parseRateProfile reads ramp:<low>:<high>, step:<low>:<high>:<at>,
+// spike:<low>:<high>:<at>:<length> or sine:<low>:<high>:<period>. Times are durations such as 5s.
+func parseRateProfile(s string) (RateProfile, error) {
+	parts := strings.Split(s, ":")
+	p := RateProfile{Shape: ProfileShape(parts[0])}
+
+	var times []*time.Duration
+	switch p.Shape {
+	case ProfileRamp:
+	case ProfileStep:
+		times = []*time.Duration{&p.At}
+	case ProfileSpike:
+		times = []*time.Duration{&p.At, &p.Length}
+	case ProfileSine:
+		times = []*time.Duration{&p.Period}
+	default:
+		return p, fmt.Errorf("unknown rate profile %q", s)
+	}
+	if len(parts) != 3+len(times) {
+		return p, fmt.Errorf("%s needs %d values, got %q", p.Shape, 2+len(times), s)
+	}
+
+	var err error
+	p.Low, err = strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return p, fmt.Errorf("%s low rate: %w", p.Shape, err)
+	}
+	p.High, err = strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return p, fmt.Errorf("%s high rate: %w", p.Shape, err)
+	}
+	for i, t := range times {
+		*t, err = time.ParseDuration(parts[3+i])
+		if err != nil {
+			return p, fmt.Errorf("%s: %w", p.Shape, err)
+		}
+	}
+	return p, p.validate()
+}
+
+// rateAt is the offered rate elapsed into the steady state window, the profile if there is one and cfg.Rate otherwise.
+// The warmup holds the profile's first rate and the cooldown its last.
+func (cfg LoadConfig) rateAt(elapsed time.Duration) float64 {
+	if cfg.Profile.Shape == "" {
+		return float64(cfg.Rate)
+	}
+	if elapsed < 0 {
+		elapsed = 0
+	} else if elapsed > cfg.Duration {
+		elapsed = cfg.Duration
+	}
+	return cfg.Profile.rate(elapsed, cfg.Duration)
+}
+
+type RateSample struct {
+	Operation string  `json:"operation"`
+	Seed      int64   `json:"seed"`
+	Profile   string  `json:"profile"`
+	Second    int     `json:"second"`   // seconds since the test started
+	Target    float64 `json:"target"`   // the profile's rate in the middle of this second
+	Offered   int     `json:"offered"`  // requests scheduled to be sent in this second
+	Achieved  int     `json:"achieved"` // successful replies that arrived in this second
+}
+
+// rateSamples buckets the steady state results into seconds of the steady state window
+func rateSamples(results []Result, cfg LoadConfig, op string) []RateSample {
+	seconds := int(math.Ceil(cfg.Duration.Seconds()))
+	for _, r := range results {
+		// replies can arrive after the test ends
+		if s := int((r.Done-cfg.Warmup)/time.Second) + 1; s > seconds {
+			seconds = s
+		}
+	}
+
+	samples := make([]RateSample, seconds)
+	for i := range samples {
+		samples[i] = RateSample{Operation: op, Seed: cfg.Seed, Profile: cfg.Profile.String(), Second: i}
+		mid := time.Duration(i)*time.Second + time.Second/2
+		if mid < cfg.Duration {
+			samples[i].Target = cfg.rateAt(mid)
+		}
+	}
+	for _, r := range results {
+		samples[int((r.Scheduled-cfg.Warmup)/time.Second)].Offered++
+		if r.Error == nil {
+			samples[int((r.Done-cfg.Warmup)/time.Second)].Achieved++
+		}
+	}
+	return samples
+}
+
+// writeRateSamples appends the per second offered and achieved rates to the _rates file
+func writeRateSamples(samples []RateSample, resultFile string) (string, error) {
+	path := resultSibling(resultFile, "rates")
+	vs := make([]any, len(samples))
+	for i, s := range samples {
+		vs[i] = s
+	}
+	return path, appendJSONL(path, vs...)
+}
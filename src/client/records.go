@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/rpc"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+
+	Raw per request records, everything report summarizes so it can be analyzed again offline
+
+*/
+
+type RequestRecord struct {
+	Test   string `json:"test"`    // the Summary operation of the test this request belongs to
+	TestID string `json:"test_id"` // the Summary TestID of the test this request belongs to
+	Seed   int64  `json:"seed"`
+	Rate   int    `json:"rate"`
+	Op     string `json:"op"`
+	Heavy  bool   `json:"heavy"`
+	Size   int    `json:"size"`
+	Conn   int64  `json:"conn"`            // 0 when no connection could be made
+	Phase  string `json:"phase,omitempty"` // warmup, steady or cooldown, only for tests with a warmup or cooldown
+
+	// wall clock unix nanoseconds
+	Scheduled int64 `json:"scheduled_ns"`
+	Start     int64 `json:"start_ns"`
+	End       int64 `json:"end_ns"`
+
+	// the same times on the server's clock, the one its instrumentation logs and timeframes use,
+	// left out when the server's clock could not be read
+	ServerScheduled int64 `json:"server_scheduled_ns,omitempty"`
+	ServerStart     int64 `json:"server_start_ns,omitempty"`
+	ServerEnd       int64 `json:"server_end_ns,omitempty"`
+
+	LatencyMs   float64 `json:"latency_ms"`
+	CorrectedMs float64 `json:"corrected_ms"`
+	ErrorClass  string  `json:"error_class,omitempty"` // empty when the request succeeded
+	Error       string  `json:"error,omitempty"`
+}
+
+// the classes errorClass sorts failures into, in the order they are printed
+var errorClasses = []string{"dial", "write", "timeout", "rpc", "decode", "connection", "other"}
+
+// errorClass sorts a request error by where it went wrong:
+// dial, the connection could not be made; write, the request could not be sent;
+// timeout, no reply within LoadConfig.Timeout; rpc, the server's method returned an error;
+// decode, the reply could not be read into the reply type; connection, the connection dropped while waiting
+func errorClass(err error) string {
+	var opErr *net.OpError
+	var serverErr rpc.ServerError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return "dial"
+	case errors.Is(err, errDeadline) || errors.Is(err, os.ErrDeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &serverErr):
+		return "rpc"
+	case errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || strings.HasPrefix(err.Error(), "reading body "):
+		// net/rpc flattens reply body errors into a string starting with "reading body"
+		return "decode"
+	case errors.As(err, &opErr) && opErr.Op == "write", errors.Is(err, rpc.ErrShutdown):
+		// a client that is already shut down never sends the request
+		return "write"
+	case isConnBroken(err), errors.As(err, &opErr):
+		return "connection"
+	}
+	return "other"
+}
+
+func requestRecord(r Result, summary Summary, cfg LoadConfig) RequestRecord {
+	rec := RequestRecord{
+		Test:        summary.Operation,
+		TestID:      summary.TestID,
+		Seed:        summary.Seed,
+		Rate:        summary.Rate,
+		Op:          r.Op,
+		Heavy:       r.Heavy,
+		Size:        r.Size,
+		Conn:        r.ConnID,
+		Scheduled:   r.TestStart.Add(r.Scheduled).UnixNano(),
+		Start:       r.TestStart.Add(r.Start).UnixNano(),
+		End:         r.TestStart.Add(r.Done).UnixNano(),
+		LatencyMs:   float64(r.Latency) / float64(time.Millisecond),
+		CorrectedMs: float64(r.Corrected) / float64(time.Millisecond),
+		ErrorClass:  errorClass(r.Error),
+	}
+	if r.ServerStart != 0 {
+		rec.ServerScheduled = r.ServerStart + int64(r.Scheduled)
+		rec.ServerStart = r.ServerStart + int64(r.Start)
+		rec.ServerEnd = r.ServerStart + int64(r.Done)
+	}
+	if cfg.Warmup > 0 || cfg.Cooldown > 0 {
+		rec.Phase = cfg.phase(r.Scheduled)
+	}
+	if r.Error != nil {
+		rec.Error = r.Error.Error()
+	}
+	return rec
+}
+
+// writeRequestRecords appends one record per request, warmup and cooldown included, to the _requests file
+func writeRequestRecords(results []Result, summary Summary, cfg LoadConfig) (string, error) {
+	path := resultSibling(cfg.ResultFile, "requests")
+	vs := make([]any, len(results))
+	for i, r := range results {
+		vs[i] = requestRecord(r, summary, cfg)
+	}
+	return path, appendJSONL(path, vs...)
+}
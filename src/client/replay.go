@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+
+	Trace driven replay, reads an arrival trace so runSchedule can send its requests at their original timing
+
+*/
+
+// one line of a JSONL trace, e.g. {"offset_ms": 12.5, "op": "sort", "heavy": true}
+type traceLine struct {
+	OffsetMs float64         `json:"offset_ms"`
+	Op       string          `json:"op"`
+	Heavy    bool            `json:"heavy"`
+	Size     int             `json:"size,omitempty"`
+	Args     json.RawMessage `json:"args,omitempty"`
+}
+
+func (l traceLine) entry() (TraceEntry, error) {
+	if _, ok := opMethods[l.Op]; !ok {
+		return TraceEntry{}, fmt.Errorf("unknown operation %q", l.Op)
+	}
+	if l.OffsetMs < 0 {
+		return TraceEntry{}, fmt.Errorf("negative offset %v", l.OffsetMs)
+	}
+	return TraceEntry{time.Duration(l.OffsetMs * float64(time.Millisecond)), l.Op, l.Heavy, l.Size, l.Args}, nil
+}
+
+// readArrivalTrace reads a .jsonl or .csv trace and returns its requests in the order they are sent.
+// CSV traces need a header naming the columns, offset_ms and op are required, heavy, size and args are optional.
+func readArrivalTrace(path string) ([]TraceEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []TraceEntry
+	switch filepath.Ext(path) {
+	case ".jsonl":
+		entries, err = readJSONLTrace(f)
+	case ".csv":
+		entries, err = readCSVTrace(f)
+	default:
+		return nil, fmt.Errorf("arrival trace must be a .jsonl or .csv file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s has no requests", path)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Offset < entries[j].Offset })
+	return entries, nil
+}
+
+func readJSONLTrace(r io.Reader) ([]TraceEntry, error) {
+	var entries []TraceEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20) // args can hold large payloads
+	for n := 1; scanner.Scan(); n++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var l traceLine
+		err := json.Unmarshal(scanner.Bytes(), &l)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		e, err := l.entry()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+func readCSVTrace(r io.Reader) ([]TraceEntry, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	cols := make(map[string]int)
+	for i, name := range rows[0] {
+		cols[strings.TrimSpace(name)] = i
+	}
+	for _, required := range []string{"offset_ms", "op"} {
+		if _, ok := cols[required]; !ok {
+			return nil, fmt.Errorf("header is missing the %s column", required)
+		}
+	}
+	field := func(row []string, name string) string {
+		i, ok := cols[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	var entries []TraceEntry
+	for n, row := range rows[1:] {
+		var l traceLine
+		l.OffsetMs, err = strconv.ParseFloat(field(row, "offset_ms"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", n+2, err)
+		}
+		l.Op = field(row, "op")
+		if v := field(row, "heavy"); v != "" {
+			l.Heavy, err = strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %w", n+2, err)
+			}
+		}
+		if v := field(row, "size"); v != "" {
+			l.Size, err = strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %w", n+2, err)
+			}
+		}
+		if v := field(row, "args"); v != "" {
+			l.Args = json.RawMessage(v)
+		}
+		e, err := l.entry()
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", n+2, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// replayDuration is how long the trace takes to send at the config's speed up
+func replayDuration(entries []TraceEntry, cfg LoadConfig) time.Duration {
+	d := time.Duration(float64(entries[len(entries)-1].Offset) / cfg.Speedup)
+	if d < time.Second {
+		// keep the throughput of very short traces meaningful
+		d = time.Second
+	}
+	return d
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+
+	Request schedules, every request of a load test worked out before the first one is sent.
+	Load tests and trace replays are both a schedule that runSchedule follows exactly.
+
+*/
+
+type TraceEntry struct {
+	Offset time.Duration   // when the request is sent, from the start of the test
+	Op     string          // hash, matmul, zlib or sort
+	Heavy  bool            // use the heavy payload instead of the light one
+	Size   int             // generate a payload of this size instead, 0 uses Heavy
+	Args   json.RawMessage // sent as the RPC arguments as-is when set, replaces the payload
+}
+
+// buildSchedule draws every arrival time, operation and payload choice of a load test.
+// The gaps come from the arrival process, the operation and heavy choices come one after another from cfg.Seed
+// and the payload sizes from a stream of their own.
+func buildSchedule(cfg LoadConfig) ([]TraceEntry, error) {
+	arrivals, err := newArrivals(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	mix := modeMix(cfg.Mode)
+	if cfg.Mix != "" {
+		mix, err = parseOpMix(cfg.Mix)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	randGen := rand.New(rand.NewSource(cfg.Seed))
+	sizeGen := rand.New(rand.NewSource(cfg.Seed + sizeSeedOffset))
+	var entries []TraceEntry
+	var offset time.Duration
+	total := cfg.Warmup + cfg.Duration + cfg.Cooldown
+	for {
+		offset += arrivals.next(cfg.rateAt(offset - cfg.Warmup))
+		if offset > total {
+			break
+		}
+		op := mix.pick(randGen)
+		heavy := randGen.Intn(100) < cfg.HeavyMix
+		e := TraceEntry{Offset: offset, Op: op, Heavy: heavy}
+		if d, ok := cfg.Sizes.forOp(e.Op); ok {
+			e.Size, e.Heavy = d.draw(sizeGen), false
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// writeSchedule saves the schedule in the arrival trace format, so it can be sent again with -replay
+func writeSchedule(entries []TraceEntry, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, e := range entries {
+		l := traceLine{float64(e.Offset) / float64(time.Millisecond), e.Op, e.Heavy, e.Size, e.Args}
+		err = enc.Encode(l)
+		if err != nil {
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// runSchedule sends every request at its offset divided by cfg.Speedup (1 when unset),
+// each request's payload is built from the schedule and cfg.Seed so it never depends on timing
+func runSchedule(cfg LoadConfig, entries []TraceEntry) []Result {
+	results := make([]Result, 0, len(entries)) // hold all the latencies
+	resultsMu := sync.Mutex{}                  // mutex to make sure adding to the results array is safe
+	var wg sync.WaitGroup
+
+	speedup := cfg.Speedup
+	if speedup == 0 {
+		speedup = 1
+	}
+
+	conn, err := newRPCConn(cfg)
+	if err != nil {
+		log.Fatal("Unable to set up connections: ", err)
+	}
+	defer conn.close()
+
+	// the request records are also put on the server's clock so they can be joined with its logs
+	readAt, serverNow, err := readServerClock(cfg.Address)
+	if err != nil {
+		log.Println("Unable to read the server's clock, the request records will only have wall clock times:", err)
+	}
+
+	// requests follow the schedule from the start of the test instead of a ticker,
+	// a ticker drops ticks when the client falls behind and that delay would never be measured
+	testStart := time.Now()
+	var serverStart int64
+	if serverNow != 0 {
+		serverStart = serverNow + int64(testStart.Sub(readAt))
+	}
+	if cfg.Timeframe != "" {
+		// the timeframe brackets the steady state window on the server's clock, not the warmup or cooldown
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(time.Until(testStart.Add(cfg.Warmup)))
+			sendExperimentBegin(cfg.Address, cfg.Timeframe)
+			time.Sleep(time.Until(testStart.Add(cfg.Warmup + time.Duration(float64(cfg.Duration)/speedup))))
+			sendExperimentEnd(cfg.Address, cfg.Timeframe)
+		}()
+	}
+	for i, e := range entries {
+		intended := testStart.Add(time.Duration(float64(e.Offset) / speedup)) // when this request should be sent
+		time.Sleep(time.Until(intended))
+		wg.Add(1)
+		go func(i int, e TraceEntry) {
+			defer wg.Done()
+			var args any = e.Args
+			if len(e.Args) == 0 {
+				var err error
+				args, err = buildArgs(e.Op, e.Heavy, e.Size, cfg.Seed+int64(i))
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+
+			start := time.Now() // start timeing
+			connID, err := conn.call(opMethods[e.Op], args, newReply(e.Op))
+			end := time.Now() // finish timing to calculate the latency
+			resultsMu.Lock()
+			results = append(results, Result{
+				Op:          e.Op,
+				Heavy:       e.Heavy,
+				Size:        payloadSize(args),
+				ConnID:      connID,
+				Latency:     end.Sub(start),
+				Corrected:   end.Sub(intended),
+				TestStart:   testStart,
+				ServerStart: serverStart,
+				Scheduled:   intended.Sub(testStart),
+				Start:       start.Sub(testStart),
+				Done:        end.Sub(testStart),
+				Error:       err,
+			})
+			resultsMu.Unlock()
+		}(i, e)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// phase is warmup, steady or cooldown for a request scheduled offset into the test
+func (cfg LoadConfig) phase(offset time.Duration) string {
+	switch {
+	case offset < cfg.Warmup:
+		return "warmup"
+	case offset >= cfg.Warmup+cfg.Duration:
+		return "cooldown"
+	}
+	return "steady"
+}
+
+// steadyResults leaves out the requests scheduled during the warmup and cooldown
+func steadyResults(results []Result, cfg LoadConfig) []Result {
+	if cfg.Warmup == 0 && cfg.Cooldown == 0 {
+		return results
+	}
+	var steady []Result
+	for _, r := range results {
+		if cfg.phase(r.Scheduled) == "steady" {
+			steady = append(steady, r)
+		}
+	}
+	return steady
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+
+	SLO search, finds the highest offered rate whose latency percentile stays under a target by running
+	load tests at a rising rate until one fails and then bisecting between the last pass and the first failure
+
+*/
+
+const (
+	sloConfidenceZ   = 1.96 // 95% two sided confidence interval of the percentile
+	sloDefaultStart  = 100  // req/s of the first probe
+	sloDefaultMax    = 100000
+	sloDefaultRepeat = 2 // load tests a probe runs before it may decide
+	sloMaxRepeat     = 5 // load tests a probe runs before it decides on the estimate alone
+	sloPrecision     = 0.05
+)
+
+type SLOSearch struct {
+	Percentile float64 // e.g. 0.99
+	SLO        float64 // ms
+	Op         string  // judge only this operation of a mixed test, empty judges every request
+	Start      int     // rate of the first probe
+	Max        int     // the search stops climbing here
+	Precision  int     // stop once the pass and the failure are this close, 0 is 5% of the passing rate
+	Repeats    int     // load tests every probe runs at least, each with the next seed
+}
+
+// one rate the search tried
+type SLOProbe struct {
+	Rate     int     `json:"rate"`
+	Value    float64 `json:"value_ms"` // the percentile of the probe's requests, -1 when it falls on a failed request
+	Lower    float64 `json:"lower_ms"` // 95% confidence interval of the percentile, -1 as for value_ms
+	Upper    float64 `json:"upper_ms"`
+	Requests int     `json:"requests"`
+	Errors   int     `json:"errors"`
+	Tests    int     `json:"tests"` // load tests it took to decide
+	Pass     bool    `json:"pass"`
+}
+
+type SLOResult struct {
+	Operation  string     `json:"operation"`
+	Op         string     `json:"op,omitempty"`
+	Seed       int64      `json:"seed"`
+	HeavyMix   int        `json:"heavy_mix"`
+	Percentile float64    `json:"percentile"` // e.g. 99.9
+	SLO        float64    `json:"slo_ms"`
+	MaxRate    int        `json:"max_rate"` // highest rate that passed, 0 if even the first probe failed
+	Limited    bool       `json:"limited"`  // max_rate is the search's upper limit, the real capacity may be higher
+	Probes     []SLOProbe `json:"probes"`
+}
+
+// parseSLOOptions takes the search's own options out of opts and returns the rest for parseLoadOptions
+func parseSLOOptions(search *SLOSearch, opts []string) ([]string, error) {
+	var rest []string
+	for _, opt := range opts {
+		name, value, _ := strings.Cut(opt, ":")
+		var err error
+		switch name {
+		case "op":
+			if _, ok := opMethods[value]; !ok {
+				err = fmt.Errorf("op must be hash, matmul, zlib or sort, got %q", value)
+			}
+			search.Op = value
+		case "start", "max", "precision", "repeats":
+			var n int
+			n, err = strconv.Atoi(value)
+			if err == nil && n <= 0 {
+				err = fmt.Errorf("%s must be positive", name)
+			}
+			switch name {
+			case "start":
+				search.Start = n
+			case "max":
+				search.Max = n
+			case "precision":
+				search.Precision = n
+			default:
+				search.Repeats = n
+			}
+		case string(ProfileRamp), string(ProfileStep), string(ProfileSpike), string(ProfileSine):
+			err = fmt.Errorf("the search sets the rate, %s cannot be used with -slo", name)
+		default:
+			rest = append(rest, opt)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rest, nil
+}
+
+// percentileBounds returns the percentile of h and its confidence interval in ms, with the failed requests
+// counted as slower than any reply. The percentile is interpolated the same way as Histogram.quantile and
+// the interval is the order statistics around rank N*q, N*q +- z*sqrt(N*q*(1-q)).
+func percentileBounds(h *Histogram, errors int, q float64) (value, lower, upper float64) {
+	n := h.count()
+	total := float64(n) + float64(errors)
+	at := func(rank float64) float64 {
+		if rank > float64(n) {
+			return math.Inf(1)
+		}
+		return h.atRank(rank) / float64(time.Millisecond)
+	}
+	spread := sloConfidenceZ * math.Sqrt(total*q*(1-q))
+	return at(1 + q*(total-1)), at(math.Floor(total*q - spread)), at(math.Ceil(total*q + spread))
+}
+
+// probe runs load tests at rate until the percentile is confidently above or below the SLO
+func (s SLOSearch) probe(cfg LoadConfig, rate int) SLOProbe {
+	h := newHistogram()
+	p := SLOProbe{Rate: rate}
+	var value, lower, upper float64
+	for p.Tests < sloMaxRepeat {
+		test := cfg
+		test.Rate = rate
+		test.Seed = cfg.Seed + int64(p.Tests)
+		all := loadTest(test)
+		report(all, test)
+		p.Tests++
+
+		for _, r := range steadyResults(all, test) {
+			if s.Op != "" && r.Op != s.Op {
+				continue
+			}
+			p.Requests++
+			if r.Error != nil {
+				p.Errors++
+				continue
+			}
+			// response time as the user sees it, including any time the request waited behind the schedule
+			h.record(r.Corrected)
+		}
+
+		value, lower, upper = percentileBounds(h, p.Errors, s.Percentile)
+		if p.Tests >= s.Repeats && (upper <= s.SLO || lower > s.SLO) {
+			break
+		}
+	}
+
+	p.Pass = value <= s.SLO
+	if lower <= s.SLO && upper > s.SLO {
+		log.Printf("%d req/s is within the confidence interval of the SLO after %d tests, deciding on the estimate\n", rate, p.Tests)
+	}
+	finite := func(v float64) float64 {
+		if math.IsInf(v, 1) {
+			return -1
+		}
+		return v
+	}
+	p.Value, p.Lower, p.Upper = finite(value), finite(lower), finite(upper)
+	return p
+}
+
+// validate checks that the judged operation is one cfg actually sends, otherwise every probe judges no requests
+func (s SLOSearch) validate(cfg LoadConfig) error {
+	if s.Op == "" {
+		return nil
+	}
+	mix := modeMix(cfg.Mode)
+	if cfg.Mix != "" {
+		var err error
+		mix, err = parseOpMix(cfg.Mix)
+		if err != nil {
+			return err
+		}
+	}
+	for _, w := range mix {
+		if w.op == s.Op && w.weight > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("op:%s is never sent by %s", s.Op, testName(cfg))
+}
+
+// run searches for the highest rate that meets the SLO, every load test is also reported to cfg.ResultFile
+func (s SLOSearch) run(cfg LoadConfig) SLOResult {
+	res := SLOResult{Operation: testName(cfg), Op: s.Op, Seed: cfg.Seed, HeavyMix: cfg.HeavyMix, Percentile: s.Percentile * 100, SLO: s.SLO}
+	try := func(rate int) bool {
+		p := s.probe(cfg, rate)
+		res.Probes = append(res.Probes, p)
+		verdict := "over"
+		if p.Pass {
+			verdict = "within"
+		}
+		log.Printf("Probe %d: %d req/s, p%v %.2fms (95%% CI %.2f - %.2fms) %s the %vms SLO\n",
+			len(res.Probes), rate, res.Percentile, p.Value, p.Lower, p.Upper, verdict, s.SLO)
+		return p.Pass
+	}
+
+	// climb until a rate fails to bracket the capacity
+	pass, fail := 0, 0
+	for rate := s.Start; fail == 0; rate *= 2 {
+		if rate > s.Max {
+			rate = s.Max
+		}
+		if !try(rate) {
+			fail = rate
+			break
+		}
+		pass = rate
+		if rate == s.Max {
+			res.Limited = true
+			break
+		}
+	}
+
+	if fail > 0 && pass == 0 {
+		// there is no passing rate to bisect from, searching below start would take a probe per halving
+		log.Printf("The first probe at %d req/s is already over the SLO, stopping\n", fail)
+		fail = 0
+	}
+
+	// then bisect between the last pass and the first failure
+	for fail > 0 {
+		precision := s.Precision
+		if precision == 0 {
+			precision = int(math.Max(1, sloPrecision*float64(pass)))
+		}
+		if fail-pass <= precision {
+			break
+		}
+		mid := (pass + fail) / 2
+		if try(mid) {
+			pass = mid
+		} else {
+			fail = mid
+		}
+	}
+	res.MaxRate = pass
+	return res
+}
+
+// writeSLOResult appends the search to the _slo file
+func writeSLOResult(res SLOResult, resultFile string) (string, error) {
+	path := resultSibling(resultFile, "slo")
+	return path, appendJSONL(path, res)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+
+	Declarative experiments, a JSON spec names the load tests to run so new experiments need no code change.
+	The pre-prepared -lt and -expr tests are bundled specs in specs/.
+
+*/
+
+//go:embed specs/*.json
+var bundledSpecs embed.FS
+
+type Spec struct {
+	Name            string      `json:"name"`
+	ResultFile      string      `json:"result_file"`      // where summaries go unless a phase names its own, empty runs without summaries
+	Shutdown        bool        `json:"shutdown"`         // shut the server down once every phase has run
+	ShutdownMessage string      `json:"shutdown_message"` // recorded by the server with its instrumentation logs
+	Phases          []SpecPhase `json:"phases"`
+}
+
+// SpecPhase runs one load test for every repetition, seed, rate, size and mode (or mix), in that nesting order
+type SpecPhase struct {
+	Label       string     `json:"label"`       // shown in the logs
+	Rates       []int      `json:"rates"`       // requests per second
+	RateRange   *RateRange `json:"rate_range"`  // added after rates, from to to inclusive
+	Duration    string     `json:"duration"`    // e.g. 1s or 10s
+	Warmup      string     `json:"warmup"`      // optional, e.g. 500ms
+	Cooldown    string     `json:"cooldown"`    // optional
+	Modes       []int      `json:"modes"`       // 0 - 4 as for -lt, default 0
+	Mixes       []string   `json:"mixes"`       // weighted operation mixes such as hash=50,sort=30,matmul=15,zlib=5, run instead of modes
+	HeavyMix    int        `json:"heavy_mix"`   // 0 to 100
+	Seeds       []int64    `json:"seeds"`       // default 1
+	Repetitions int        `json:"repetitions"` // default 1
+	Connections string     `json:"connections"` // per-request, pool:<N> or multiplex
+	Arrival     string     `json:"arrival"`     // fixed, poisson, pareto[:alpha] or lognormal[:sigma]
+	Profile     string     `json:"profile"`     // a rate profile such as ramp:100:2000, rates are then ignored by the schedule
+	Sizes       []string   `json:"sizes"`       // payload sizes as for the size: option, e.g. fixed:1000 or uniform:100:1000, one load test each
+	Timeout     string     `json:"timeout"`     // per request deadline
+	Timeframe   string     `json:"timeframe"`   // server timeframe label for the steady state of each test
+	ResultFile  string     `json:"result_file"` // overrides the spec's result file
+}
+
+type RateRange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+	Step int `json:"step"`
+}
+
+// readSpec reads a spec file, or a bundled spec by name (lt1, expr1...) when no such file exists
+func readSpec(path string) (Spec, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return bundledSpec(strings.TrimSuffix(path, ".json"))
+	}
+	if err != nil {
+		return Spec{}, err
+	}
+	return parseSpec(data, path)
+}
+
+// bundledSpec returns one of the specs built into the client
+func bundledSpec(name string) (Spec, error) {
+	data, err := bundledSpecs.ReadFile("specs/" + name + ".json")
+	if err != nil {
+		return Spec{}, fmt.Errorf("%s is neither a file nor a bundled spec", name)
+	}
+	return parseSpec(data, name)
+}
+
+func parseSpec(data []byte, name string) (Spec, error) {
+	var spec Spec
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields() // a misspelled field would otherwise silently run the default
+	err := dec.Decode(&spec)
+	if err != nil {
+		return spec, fmt.Errorf("%s: %w", name, err)
+	}
+	return spec, nil
+}
+
+// configs expands the phase into the load tests it runs against addr
+func (p SpecPhase) configs(addr string, resultFile string) ([]LoadConfig, error) {
+	rates := append([]int(nil), p.Rates...)
+	if r := p.RateRange; r != nil {
+		if r.Step <= 0 || r.From > r.To {
+			return nil, fmt.Errorf("rate_range needs from <= to and a positive step")
+		}
+		for rate := r.From; rate <= r.To; rate += r.Step {
+			rates = append(rates, rate)
+		}
+	}
+	if len(rates) == 0 {
+		if p.Profile == "" {
+			return nil, fmt.Errorf("needs rates, a rate_range or a profile")
+		}
+		rates = []int{0} // the profile sets the rate
+	}
+	modes := p.Modes
+	if len(modes) == 0 {
+		modes = []int{0}
+	}
+	mixes := []string{""} // the mode picks the operations
+	if len(p.Mixes) > 0 {
+		if len(p.Modes) > 0 {
+			return nil, fmt.Errorf("needs modes or mixes, not both")
+		}
+		for _, mix := range p.Mixes {
+			if _, err := parseOpMix(mix); err != nil {
+				return nil, err
+			}
+		}
+		modes, mixes = []int{0}, p.Mixes
+	}
+	seeds := p.Seeds
+	if len(seeds) == 0 {
+		seeds = []int64{1}
+	}
+	repetitions := p.Repetitions
+	if repetitions == 0 {
+		repetitions = 1
+	}
+	if p.ResultFile != "" {
+		resultFile = p.ResultFile
+	}
+
+	base := LoadConfig{Address: addr, HeavyMix: p.HeavyMix, ResultFile: resultFile, Timeframe: p.Timeframe}
+	var err error
+	base.Duration, err = time.ParseDuration(p.Duration)
+	if err != nil || base.Duration <= 0 {
+		return nil, fmt.Errorf("needs a positive duration such as 1s, got %q", p.Duration)
+	}
+	// the remaining fields are written the same way as the -lt options
+	var opts []string
+	for _, opt := range [][2]string{{"warmup:", p.Warmup}, {"cooldown:", p.Cooldown}, {"timeout:", p.Timeout},
+		{"", p.Connections}, {"", p.Arrival}, {"", p.Profile}} {
+		if opt[1] != "" {
+			opts = append(opts, opt[0]+opt[1])
+		}
+	}
+	err = parseLoadOptions(&base, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := []PayloadSizes{nil} // the fixed heavy and light payloads
+	if len(p.Sizes) > 0 {
+		sizes = sizes[:0]
+		for _, s := range p.Sizes {
+			parsed, err := parsePayloadSizes(s)
+			if err != nil {
+				return nil, err
+			}
+			sizes = append(sizes, parsed)
+		}
+	}
+
+	var configs []LoadConfig
+	for rep := 0; rep < repetitions; rep++ {
+		for _, seed := range seeds {
+			for _, rate := range rates {
+				for _, size := range sizes {
+					for _, mode := range modes {
+						if mode < 0 || mode > 4 {
+							return nil, fmt.Errorf("mode must be 0 - 4, got %d", mode)
+						}
+						for _, mix := range mixes {
+							cfg := base
+							cfg.Seed, cfg.Rate, cfg.Sizes, cfg.Mode, cfg.Mix = seed, rate, size, mode, mix
+							configs = append(configs, cfg)
+						}
+					}
+				}
+			}
+		}
+	}
+	return configs, nil
+}
+
+// runSpec runs every phase of the spec against addr, the whole spec is checked before the first test starts
+func runSpec(spec Spec, addr string) {
+	phases := make([][]LoadConfig, len(spec.Phases))
+	var total time.Duration
+	for i, p := range spec.Phases {
+		configs, err := p.configs(addr, spec.ResultFile)
+		if err != nil {
+			log.Fatalf("Spec %s phase %d (%s): %v", spec.Name, i+1, p.Label, err)
+		}
+		phases[i] = configs
+		for _, cfg := range configs {
+			total += cfg.Warmup + cfg.Duration + cfg.Cooldown
+		}
+	}
+	if len(phases) == 0 {
+		log.Fatalf("Spec %s has no phases", spec.Name)
+	}
+
+	log.Printf("Processing %s, please wait about %v!\n", spec.Name, total.Round(time.Second))
+	var results []string
+	written := make(map[string]bool)
+	for i, configs := range phases {
+		log.Printf("Phase %d of %d: %s, %d load tests\n", i+1, len(phases), spec.Phases[i].Label, len(configs))
+		for _, cfg := range configs {
+			res := loadTest(cfg)
+			if cfg.ResultFile == "" {
+				continue
+			}
+			report(res, cfg)
+			if !written[cfg.ResultFile] {
+				written[cfg.ResultFile] = true
+				results = append(results, cfg.ResultFile)
+			}
+		}
+	}
+
+	if spec.Shutdown {
+		sendShutdown(addr, spec.ShutdownMessage)
+	}
+	if len(results) == 0 {
+		log.Println("Finished Processing test, Results in", outputPath(""))
+	} else {
+		log.Println("Finished Processing test, Results in", strings.Join(results, ", "))
+	}
+}
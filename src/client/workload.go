@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+/*
+
+	The operations the load generator can send and the payloads that go with them
+
+*/
+
+// operation names used by arrival traces
+const (
+	OpHash   = "hash"
+	OpMatMul = "matmul"
+	OpZlib   = "zlib"
+	OpSort   = "sort"
+)
+
+// how each operation is named in summaries, the same as the single operation modes
+var opNames = map[string]string{
+	OpHash:   "String Hashing",
+	OpMatMul: "Matrix Multiplication",
+	OpZlib:   "Zlib Compression",
+	OpSort:   "Array Sort",
+}
+
+var opMethods = map[string]string{
+	OpHash:   "GetHash.HashCompute",
+	OpMatMul: "MatrixMultiply.MultiplyMatrix",
+	OpZlib:   "Zlib.ZlibCompress",
+	OpSort:   "ArraySort.SortArray",
+}
+
+// one operation of a mix and its share of the requests
+type opWeight struct {
+	op     string
+	weight int
+}
+
+// OpMix is the operations a load test sends and how often, in the order their shares are drawn from
+type OpMix []opWeight
+
+// modeMix is the mix of a -lt mode. The weights keep the draws of the original 0-100 ranges,
+// so a seed sends the same operations it always has.
+func modeMix(mode int) OpMix {
+	switch mode {
+	case 0:
+		return OpMix{{OpHash, 25}, {OpMatMul, 25}, {OpZlib, 25}, {OpSort, 25}}
+	case 1:
+		return OpMix{{OpHash, 24}}
+	case 2:
+		return OpMix{{OpMatMul, 24}}
+	case 3:
+		return OpMix{{OpZlib, 24}}
+	default:
+		return OpMix{{OpSort, 25}}
+	}
+}
+
+// parseOpMix reads a weighted mix such as hash=50,sort=30,matmul=15,zlib=5. Weights are whole numbers
+// and need not add up to 100, an operation left out is never sent.
+func parseOpMix(s string) (OpMix, error) {
+	var mix OpMix
+	total := 0
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		op, weight, ok := strings.Cut(part, "=")
+		if _, known := opMethods[op]; !known || !ok {
+			return nil, fmt.Errorf("mix entries are <op>=<weight> with op hash, matmul, zlib or sort, got %q", part)
+		}
+		if seen[op] {
+			return nil, fmt.Errorf("mix has %s more than once", op)
+		}
+		seen[op] = true
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("mix weight of %s must be a whole number that is not negative, got %q", op, weight)
+		}
+		mix = append(mix, opWeight{op, w})
+		total += w
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("mix needs a positive weight, got %q", s)
+	}
+	return mix, nil
+}
+
+// pick draws the operation of the next request
+func (m OpMix) pick(randGen *rand.Rand) string {
+	total := 0
+	for _, w := range m {
+		total += w.weight
+	}
+	choice := randGen.Intn(total)
+	for _, w := range m {
+		if choice < w.weight {
+			return w.op
+		}
+		choice -= w.weight
+	}
+	return m[len(m)-1].op
+}
+
+// newReply returns somewhere to decode the reply of op into
+func newReply(op string) any {
+	switch op {
+	case OpHash:
+		return new(string)
+	case OpMatMul:
+		return new([]float64)
+	case OpSort:
+		return new([]int32)
+	default:
+		return new([]byte)
+	}
+}
+
+// buildArgs returns the RPC arguments of op. A size above 0 generates a payload of that many
+// bytes or elements (the matrix side for matmul) from seed, otherwise the fixed heavy or light payload is used.
+func buildArgs(op string, heavy bool, size int, seed int64) (any, error) {
+	if size > 0 {
+		randGen := rand.New(rand.NewSource(seed))
+		switch op {
+		case OpHash:
+			data := randomText(randGen, size)
+			return HashArgs{data, len(data)}, nil
+		case OpZlib:
+			data := randomText(randGen, size)
+			return ZlibArgs{data, len(data)}, nil
+		case OpSort:
+			data := make([]int32, size)
+			for i := range data {
+				data[i] = randGen.Int31n(1000)
+			}
+			return SortArgs{data, len(data)}, nil
+		case OpMatMul:
+			arr1, arr2 := make([]float64, size*size), make([]float64, size*size)
+			for i := range arr1 {
+				arr1[i], arr2[i] = float64(randGen.Intn(100)), float64(randGen.Intn(100))
+			}
+			return MatMutArgs{arr1, arr2, size}, nil
+		}
+		return nil, fmt.Errorf("unknown operation %q", op)
+	}
+
+	switch op {
+	case OpHash:
+		if heavy {
+			return HashArgs{[]byte(LARGE_TEXT), len(LARGE_TEXT)}, nil
+		}
+		data := []byte("As the blue one says, Gotta go fast")
+		return HashArgs{data, len(data)}, nil
+	case OpZlib:
+		if heavy {
+			return ZlibArgs{[]byte(LARGE_TEXT), len(LARGE_TEXT)}, nil
+		}
+		return ZlibArgs{[]byte("I am crushed and reborn!"), 24}, nil
+	case OpSort:
+		if heavy {
+			return SortArgs{LARGE_ARR300, len(LARGE_ARR300)}, nil
+		}
+		data := []int32{1, 5, 9, 27, 3, 5, 8, 1, 9, 7, 11}
+		return SortArgs{data, len(data)}, nil
+	case OpMatMul:
+		if heavy {
+			return MatMutArgs{LARGE_ARR1, LARGE_ARR2, 6}, nil
+		}
+		return MatMutArgs{[]float64{1, 2, 3, 4}, []float64{5, 6, 7, 8}, 2}, nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", op)
+}
+
+// payloadSize is the bytes or elements in args, the matrix side for matmul, or the bytes of raw JSON args
+func payloadSize(args any) int {
+	switch a := args.(type) {
+	case HashArgs:
+		return len(a.Data)
+	case ZlibArgs:
+		return len(a.Data)
+	case SortArgs:
+		return len(a.Data)
+	case MatMutArgs:
+		return a.Size
+	case json.RawMessage:
+		return len(a)
+	}
+	return 0
+}
+
+// randomText is size bytes of LARGE_TEXT starting at a random point, so it compresses like the fixed payloads
+func randomText(randGen *rand.Rand, size int) []byte {
+	data := make([]byte, size)
+	offset := randGen.Intn(len(LARGE_TEXT))
+	for i := range data {
+		data[i] = LARGE_TEXT[(offset+i)%len(LARGE_TEXT)]
+	}
+	return data
+}
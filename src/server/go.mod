@@ -0,0 +1,3 @@
+module go-scheduling-under-the-hood/server
+
+go 1.21.13
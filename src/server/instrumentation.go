@@ -0,0 +1,13 @@
+package main
+
+// instrumentationBackend is what the server needs from runtime/instrumentation_export.
+// That package only exists in the forked toolchains under utils/, so building with
+// -tags instrumented uses it and a stock Go build falls back to runtime/metrics and time.
+type instrumentationBackend interface {
+	NanotimeNow() int64          // runtime clock the instrumentation timestamps are taken with
+	ReturnSchedulerType() string // which scheduler the server was built with
+	DumpCyclesLogsToFile(path string)
+	DumpInstrumentationLogsToFile(path string)
+	DumpGStatusLogsToFile(path string)
+	DumpQSizeLogsToFile(path string)
+}
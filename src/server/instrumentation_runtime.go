@@ -0,0 +1,34 @@
+//go:build instrumented
+
+package main
+
+import "runtime/instrumentation_export"
+
+// built with one of the instrumented toolchains, the real runtime logs are used
+var backend instrumentationBackend = runtimeBackend{}
+
+type runtimeBackend struct{}
+
+func (runtimeBackend) NanotimeNow() int64 {
+	return instrumentation_export.NanotimeNow()
+}
+
+func (runtimeBackend) ReturnSchedulerType() string {
+	return instrumentation_export.ReturnSchedulerType()
+}
+
+func (runtimeBackend) DumpCyclesLogsToFile(path string) {
+	instrumentation_export.DumpCyclesLogsToFile(path)
+}
+
+func (runtimeBackend) DumpInstrumentationLogsToFile(path string) {
+	instrumentation_export.DumpInstrumentationLogsToFile(path)
+}
+
+func (runtimeBackend) DumpGStatusLogsToFile(path string) {
+	instrumentation_export.DumpGStatusLogsToFile(path)
+}
+
+func (runtimeBackend) DumpQSizeLogsToFile(path string) {
+	instrumentation_export.DumpQSizeLogsToFile(path)
+}
@@ -0,0 +1,42 @@
+//go:build !instrumented
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	_ "unsafe" // for go:linkname
+)
+
+// built with stock Go, there are no runtime logs so dumps write nothing
+var backend instrumentationBackend = stockBackend{}
+
+// the runtime's monotonic clock, the same one runtime/trace timestamps its events with. time.Since from a
+// start time would be offset from every trace by however long the process ran before it, so converted traces
+// and the server's timeframes would not line up. The runtime marks nanotime as linknamable and promises to
+// keep its signature (go.dev/issue/67401), so -checklinkname allows this on current toolchains.
+//
+//go:linkname nanotime runtime.nanotime
+func nanotime() int64
+
+type stockBackend struct{}
+
+func (stockBackend) NanotimeNow() int64 {
+	return nanotime()
+}
+
+func (stockBackend) ReturnSchedulerType() string {
+	// stock Go preempts asynchronously unless it has been turned off
+	sched := "Preemptive"
+	if strings.Contains(os.Getenv("GODEBUG"), "asyncpreemptoff=1") {
+		sched = "Cooperative"
+	}
+	return fmt.Sprintf("Stock %s (%s, GOMAXPROCS=%d, no instrumentation)", runtime.Version(), sched, runtime.GOMAXPROCS(0))
+}
+
+func (stockBackend) DumpCyclesLogsToFile(path string)          {}
+func (stockBackend) DumpInstrumentationLogsToFile(path string) {}
+func (stockBackend) DumpGStatusLogsToFile(path string)         {}
+func (stockBackend) DumpQSizeLogsToFile(path string)           {}
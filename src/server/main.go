@@ -1,48 +1,134 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net"
 	"net/rpc"
 	"net/rpc/jsonrpc"
 	"os"
-	"runtime/instrumentation_export"
+	"os/signal"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+// how long Ctrl-C waits for in-flight RPCs to finish before dumping anyway
+const drainTimeout = 5 * time.Second
+
+// number of RPCs that have been read but not yet responded to
+var inFlight atomic.Int64
+
+// trackedCodec wraps a ServerCodec so we know how many requests are still being handled
+type trackedCodec struct {
+	rpc.ServerCodec
+}
+
+func (c trackedCodec) ReadRequestHeader(r *rpc.Request) error {
+	err := c.ServerCodec.ReadRequestHeader(r)
+	if err == nil {
+		// net/rpc always writes a response for a header it managed to read
+		inFlight.Add(1)
+	}
+	return err
+}
+
+func (c trackedCodec) WriteResponse(r *rpc.Response, body any) error {
+	defer inFlight.Add(-1)
+	return c.ServerCodec.WriteResponse(r, body)
+}
+
 func help() {
 	fmt.Println(helpMessage)
 }
 
+func acceptConnections(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Println("Accept error:", err)
+			continue
+		}
+		go rpc.ServeCodec(trackedCodec{jsonrpc.NewServerCodec(conn)})
+	}
+}
+
+// waits until every in-flight RPC has responded or the timeout passes
+func drainRequests(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for inFlight.Load() > 0 {
+		if time.Now().After(deadline) {
+			log.Printf("Drain timed out with %d RPCs still in flight\n", inFlight.Load())
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func main() {
-	argsLen := len(os.Args)
-	if argsLen == 2 {
+	outRoot := flag.String("out", "../json_results", "root directory the instrumentation logs are dumped under")
+	runID := flag.String("run", "", "run ID, logs are dumped to <out>/<run>")
+	rtInterval := flag.Duration("rtmetrics", 100*time.Millisecond, "how often runtime/metrics is sampled, 0 turns it off")
+	flag.Usage = help
+	flag.Parse()
+
+	if flag.NArg() == 1 {
 		log.SetOutput(os.Stdout)
 		log.SetFlags(log.LstdFlags | log.Lmicroseconds)
+
+		outputDir = filepath.Join(*outRoot, *runID)
+		err := os.MkdirAll(outputDir, 0755)
+		if err != nil {
+			log.Fatal("Unable to create output directory:", err)
+		}
+
 		rpc.Register(new(GetHash))
 		rpc.Register(new(ArraySort))
 		rpc.Register(new(MatrixMultiply))
 		rpc.Register(new(Zlib))
 		rpc.Register(new(Shutdown))
+		rpc.Register(new(Instrumentation))
+		rpc.Register(new(Experiment))
+		rpc.Register(new(Profile))
 
-		listener, err := net.Listen("tcp", os.Args[1])
+		listener, err := net.Listen("tcp", flag.Arg(0))
 		if err != nil {
 			log.Fatal("Listen error:", err)
 		}
-		log.Println("Goroutine instrumentation enabled: ", instrumentation_export.ReturnSchedulerType())
-		log.Println("JSON-RPC server listening on: ", os.Args[1])
+		log.Println("Goroutine instrumentation enabled: ", backend.ReturnSchedulerType())
+		log.Println("JSON-RPC server listening on: ", flag.Arg(0))
+		log.Println("Instrumentation logs will be dumped to: ", outputDir)
+
+		if *rtInterval > 0 {
+			go sampleRuntimeMetrics(*rtInterval)
+		}
+
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
 
 		// -----------------------------------------------------
-		// Accept connections forever (until Ctrl-C is pressed)
+		// Accept connections until Ctrl-C (or SIGTERM) is received
 		// -----------------------------------------------------
-		for {
-			conn, err := listener.Accept()
-			if err != nil {
-				log.Println("Accept error:", err)
-				continue
-			}
-			go rpc.ServeCodec(jsonrpc.NewServerCodec(conn))
+		go acceptConnections(listener)
+
+		sig := <-sigs
+		log.Printf("Received %v, no longer accepting connections\n", sig)
+		listener.Close()
+
+		drainRequests(drainTimeout)
+
+		log.Println("Dumping instrumentation logs...")
+		_, err = dumpInstrumentation(outputDir, fmt.Sprintf("Server stopped by signal: %v", sig))
+		if err != nil {
+			log.Fatal(err)
 		}
+		log.Println("Logs dumped, server shutting down.")
 
 	} else {
 		help()
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"time"
+)
+
+/*
+
+	On-demand runtime/trace and pprof capture, so the handlers can be looked at
+	while a load test is running without rebuilding the server
+
+*/
+
+// mutex contention is sampled 1 in this many events while Profile.Capture runs
+const mutexProfileFraction = 5
+
+type Profile struct{}
+
+type ProfileArgs struct {
+	Seconds int    // how long the trace or CPU profile records for
+	Label   string // prefix of the files written to the run directory, defaults to the current time
+}
+
+type ProfileFiles struct {
+	Files []string // paths of the files that were written
+}
+
+func (args ProfileArgs) validate() (time.Duration, string, error) {
+	if args.Seconds <= 0 {
+		return 0, "", errors.New("the number of seconds to record must be positive")
+	}
+	label := args.Label
+	if label == "" {
+		label = time.Now().Format("20060102-150405")
+	}
+	if filepath.Base(label) != label {
+		return 0, "", errors.New("the label must not contain a path")
+	}
+	return time.Duration(args.Seconds) * time.Second, label, nil
+}
+
+// Trace records a runtime/trace for args.Seconds to <label>_trace.out, replying once the file is complete.
+// traceconv turns the file into instrumentation.jsonl and goroutine_status.jsonl.
+func (p *Profile) Trace(args ProfileArgs, reply *ProfileFiles) error {
+	d, label, err := args.validate()
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(outputDir, label+"_trace.out")
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = trace.Start(f)
+	if err != nil {
+		// usually a trace is already running, do not leave an empty file behind
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	log.Printf("Recording runtime/trace for %v to: %s\n", d, path)
+	time.Sleep(d)
+	trace.Stop()
+
+	*reply = ProfileFiles{Files: []string{path}}
+	return f.Close()
+}
+
+// Capture records a CPU profile for args.Seconds, then snapshots the goroutine and mutex profiles.
+// The files are <label>_cpu.pprof, <label>_goroutine.pprof and <label>_mutex.pprof.
+func (p *Profile) Capture(args ProfileArgs, reply *ProfileFiles) error {
+	d, label, err := args.validate()
+	if err != nil {
+		return err
+	}
+
+	// the mutex profile only has the contention seen while sampling was on
+	prev := runtime.SetMutexProfileFraction(mutexProfileFraction)
+	defer runtime.SetMutexProfileFraction(prev)
+
+	cpuPath := filepath.Join(outputDir, label+"_cpu.pprof")
+	f, err := os.Create(cpuPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = pprof.StartCPUProfile(f)
+	if err != nil {
+		// usually a CPU profile is already running, do not leave an empty file behind
+		f.Close()
+		os.Remove(cpuPath)
+		return err
+	}
+	log.Printf("Recording CPU profile for %v to: %s\n", d, cpuPath)
+	time.Sleep(d)
+	pprof.StopCPUProfile()
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	files := []string{cpuPath}
+	for _, name := range []string{"goroutine", "mutex"} {
+		path := filepath.Join(outputDir, label+"_"+name+".pprof")
+		err = writeProfile(name, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, path)
+	}
+
+	*reply = ProfileFiles{Files: files}
+	return nil
+}
+
+func writeProfile(name string, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = pprof.Lookup(name).WriteTo(f, 0)
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
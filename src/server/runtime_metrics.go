@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"os"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+
+	runtime/metrics sampler, a coarse view of the scheduler from the official runtime numbers
+	that can be cross-checked against the custom instrumentation (and works on stock Go)
+
+*/
+
+const (
+	schedLatenciesMetric = "/sched/latencies:seconds"
+	goroutinesMetric     = "/sched/goroutines:goroutines"
+)
+
+type RuntimeMetricsSample struct {
+	Timestamp         int64              // backend.NanotimeNow(), the same clock as the timeframes
+	Goroutines        uint64             // live goroutines
+	SchedLatencyCount uint64             // goroutines that were scheduled since the previous sample
+	SchedLatencyP50   float64            // scheduling latency percentiles since the previous sample (seconds), 0 if none
+	SchedLatencyP95   float64            //
+	SchedLatencyP99   float64            //
+	GC                map[string]float64 // every scalar /gc/* metric by name
+}
+
+// at most this many samples are held, an hour at the default interval, after that the oldest are overwritten
+const maxRuntimeMetricsSamples = 36000
+
+var runtimeMetricsMu sync.Mutex
+var runtimeMetrics []RuntimeMetricsSample // ring of samples, the oldest is at runtimeMetricsNext once it is full
+var runtimeMetricsNext int
+
+// addRuntimeMetrics holds rs, overwriting the oldest sample once maxRuntimeMetricsSamples are held
+func addRuntimeMetrics(rs RuntimeMetricsSample) {
+	runtimeMetricsMu.Lock()
+	defer runtimeMetricsMu.Unlock()
+
+	if len(runtimeMetrics) < maxRuntimeMetricsSamples {
+		runtimeMetrics = append(runtimeMetrics, rs)
+		return
+	}
+	if runtimeMetricsNext == 0 {
+		log.Printf("Holding %d runtime metrics samples, the oldest are being dropped until the next reset\n", maxRuntimeMetricsSamples)
+	}
+	runtimeMetrics[runtimeMetricsNext] = rs
+	runtimeMetricsNext = (runtimeMetricsNext + 1) % maxRuntimeMetricsSamples
+}
+
+// heldRuntimeMetrics returns the samples held oldest first, runtimeMetricsMu must be held
+func heldRuntimeMetrics() []RuntimeMetricsSample {
+	return append(runtimeMetrics[runtimeMetricsNext:len(runtimeMetrics):len(runtimeMetrics)], runtimeMetrics[:runtimeMetricsNext]...)
+}
+
+// sampleRuntimeMetrics reads runtime/metrics every interval until the server exits
+func sampleRuntimeMetrics(interval time.Duration) {
+	samples := []metrics.Sample{{Name: schedLatenciesMetric}, {Name: goroutinesMetric}}
+	for _, d := range metrics.All() {
+		if strings.HasPrefix(d.Name, "/gc/") && (d.Kind == metrics.KindUint64 || d.Kind == metrics.KindFloat64) {
+			samples = append(samples, metrics.Sample{Name: d.Name})
+		}
+	}
+
+	var prevCounts []uint64
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		metrics.Read(samples)
+		rs := RuntimeMetricsSample{
+			Timestamp: backend.NanotimeNow(),
+			GC:        make(map[string]float64),
+		}
+
+		for _, s := range samples {
+			switch s.Name {
+			case schedLatenciesMetric:
+				if s.Value.Kind() != metrics.KindFloat64Histogram {
+					continue
+				}
+				h := s.Value.Float64Histogram()
+				// the histogram is cumulative, only look at what changed since the last sample
+				delta := make([]uint64, len(h.Counts))
+				for i, c := range h.Counts {
+					delta[i] = c
+					if i < len(prevCounts) {
+						delta[i] -= prevCounts[i]
+					}
+				}
+				prevCounts = append(prevCounts[:0], h.Counts...)
+
+				rs.SchedLatencyCount, rs.SchedLatencyP50 = histogramPercentile(delta, h.Buckets, 0.50)
+				_, rs.SchedLatencyP95 = histogramPercentile(delta, h.Buckets, 0.95)
+				_, rs.SchedLatencyP99 = histogramPercentile(delta, h.Buckets, 0.99)
+			case goroutinesMetric:
+				if s.Value.Kind() == metrics.KindUint64 {
+					rs.Goroutines = s.Value.Uint64()
+				}
+			default:
+				switch s.Value.Kind() {
+				case metrics.KindUint64:
+					rs.GC[s.Name] = float64(s.Value.Uint64())
+				case metrics.KindFloat64:
+					rs.GC[s.Name] = s.Value.Float64()
+				}
+			}
+		}
+
+		addRuntimeMetrics(rs)
+	}
+}
+
+// histogramPercentile returns the number of samples and the upper bound of the bucket holding the pct percentile
+func histogramPercentile(counts []uint64, buckets []float64, pct float64) (uint64, float64) {
+	var total uint64
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return 0, 0
+	}
+
+	target := uint64(math.Ceil(float64(total) * pct))
+	var seen uint64
+	for i, c := range counts {
+		seen += c
+		if seen >= target {
+			// buckets[i+1] is the upper bound, the last one can be +Inf
+			if math.IsInf(buckets[i+1], 1) {
+				return total, buckets[i]
+			}
+			return total, buckets[i+1]
+		}
+	}
+	return total, buckets[len(buckets)-1]
+}
+
+// countRuntimeMetrics is the number of samples held that were taken at or after since
+func countRuntimeMetrics(since int64) int {
+	runtimeMetricsMu.Lock()
+	defer runtimeMetricsMu.Unlock()
+
+	count := 0
+	for _, rs := range heldRuntimeMetrics() {
+		if rs.Timestamp >= since {
+			count++
+		}
+	}
+	return count
+}
+
+// trimRuntimeMetrics drops the samples taken before mark, Reset has drained them
+func trimRuntimeMetrics(mark int64) {
+	runtimeMetricsMu.Lock()
+	defer runtimeMetricsMu.Unlock()
+
+	var kept []RuntimeMetricsSample
+	for _, rs := range heldRuntimeMetrics() {
+		if rs.Timestamp >= mark {
+			kept = append(kept, rs)
+		}
+	}
+	runtimeMetrics, runtimeMetricsNext = kept, 0
+}
+
+// writeRuntimeMetrics writes every sample held that was taken at or after since and before until (0 for no limit) to path
+func writeRuntimeMetrics(path string, since int64, until int64) (int, error) {
+	runtimeMetricsMu.Lock()
+	defer runtimeMetricsMu.Unlock()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	count := 0
+	enc := json.NewEncoder(f)
+	for _, rs := range heldRuntimeMetrics() {
+		if rs.Timestamp < since || until != 0 && rs.Timestamp >= until {
+			continue
+		}
+		err = enc.Encode(rs)
+		if err != nil {
+			log.Println("Unable to write runtime metrics sample:", err)
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
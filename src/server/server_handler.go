@@ -5,20 +5,30 @@ import (
 	"compress/zlib"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
-	"runtime/instrumentation_export"
+	"sync"
+	"sync/atomic"
 )
 
 const helpMessage = `
 Usage:
-  ./main <server:port>
+  ./main [-out <directory>] [-run <run-id>] [-rtmetrics <interval>] <server:port>
+
+Options:
+  -out: Root directory the instrumentation logs are dumped under (default ../json_results)
+  -run: Run ID, logs are dumped to <out>/<run-id> so experiments do not overwrite each other
+  -rtmetrics: How often runtime/metrics is sampled into runtime_metrics.jsonl, 0 turns it off (default 100ms)
   `
 
+// where Shutdown.Exit and Ctrl-C dump the instrumentation logs, set from -out and -run
+var outputDir = "../json_results"
+
 // Compute Hash
 
 type HashArgs struct {
@@ -162,15 +172,7 @@ type ShutdownArgs struct {
 
 func (s *Shutdown) Exit(args ShutdownArgs, reply *string) error {
 	log.Println("Shutdown requested. Dumping instrumentation logs...")
-	instrumentation_export.DumpCyclesLogsToFile("../json_results/cycles_events.jsonl")
-	instrumentation_export.DumpInstrumentationLogsToFile("../json_results/instrumentation.jsonl")
-	instrumentation_export.DumpGStatusLogsToFile("../json_results/goroutine_status.jsonl")
-	instrumentation_export.DumpQSizeLogsToFile("../json_results/queue_size.jsonl")
-
-	d1 := []byte(fmt.Sprintf("This data is from a scheduler of type: %s\n%s", instrumentation_export.ReturnSchedulerType(), args.Message))
-	path1 := filepath.Join("../json_results", "experiment_info.txt")
-	err := os.WriteFile(path1, d1, 0644)
-
+	_, err := dumpInstrumentation(outputDir, args.Message)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -183,3 +185,322 @@ func (s *Shutdown) Exit(args ShutdownArgs, reply *string) error {
 	}()
 	return nil
 }
+
+// dumpMu stops Shutdown.Exit, the signal handler and Instrumentation from writing the same files at once
+var dumpMu sync.Mutex
+
+// the runtime logs, the file they are dumped to and how to dump them
+var instrumentationLogs = []struct {
+	file string
+	dump func(path string)
+}{
+	{"cycles_events.jsonl", backend.DumpCyclesLogsToFile},
+	{"instrumentation.jsonl", backend.DumpInstrumentationLogsToFile},
+	{"goroutine_status.jsonl", backend.DumpGStatusLogsToFile},
+	{"queue_size.jsonl", backend.DumpQSizeLogsToFile},
+}
+
+// dumpInstrumentation writes all of the runtime instrumentation logs and the
+// experiment info file to dir, this is the dump path for Shutdown.Exit, Ctrl-C and Instrumentation.Dump
+func dumpInstrumentation(dir string, message string) (map[string]int, error) {
+	dumpMu.Lock()
+	defer dumpMu.Unlock()
+
+	counts, err := dumpLogs(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	dumpedCounts, dumpedAt = counts, backend.NanotimeNow()
+
+	d1 := []byte(fmt.Sprintf("This data is from a scheduler of type: %s\n%s", backend.ReturnSchedulerType(), message))
+	path1 := filepath.Join(dir, "experiment_info.txt")
+	return counts, os.WriteFile(path1, d1, 0644)
+}
+
+// dumpLogs writes every runtime log into dir, dropping anything recorded before the last
+// Instrumentation.Reset or at or after until (0 for no limit), and returns how many events each file holds
+func dumpLogs(dir string, until int64) (map[string]int, error) {
+	counts := make(map[string]int)
+	since := resetMark.Load()
+	for _, l := range instrumentationLogs {
+		path := filepath.Join(dir, l.file)
+		// a file left from an earlier run must never be mistaken for this dump
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		l.dump(path)
+		n, err := filterLog(path, since, until)
+		if err != nil {
+			return nil, err
+		}
+		counts[l.file] = n
+	}
+
+	n, err := writeTimeframes(filepath.Join(dir, "timeframe.jsonl"), since, until)
+	if err != nil {
+		return nil, err
+	}
+	counts["timeframe.jsonl"] = n
+
+	n, err = writeRuntimeMetrics(filepath.Join(dir, "runtime_metrics.jsonl"), since, until)
+	if err != nil {
+		return nil, err
+	}
+	counts["runtime_metrics.jsonl"] = n
+	return counts, nil
+}
+
+// filterLog rewrites a dumped jsonl log keeping only events at or after since and before until,
+// and returns the number of events kept. A since or until of 0 leaves that side open.
+func filterLog(path string, since int64, until int64) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		// nothing was recorded for this log
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	var kept bytes.Buffer
+	count := 0
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var ev struct{ Timestamp int64 }
+		if err := json.Unmarshal(line, &ev); err != nil {
+			return 0, fmt.Errorf("%s: %w", path, err)
+		}
+		if ev.Timestamp < since || until != 0 && ev.Timestamp >= until {
+			continue
+		}
+		kept.Write(line)
+		kept.WriteByte('\n')
+		count++
+	}
+
+	if since == 0 && until == 0 {
+		return count, nil
+	}
+	return count, os.WriteFile(path, kept.Bytes(), 0644)
+}
+
+/*
+
+	Instrumentation control, lets one server process be used for many load phases
+
+*/
+
+// events recorded before this runtime timestamp are left out of every dump, 0 means keep everything
+var resetMark atomic.Int64
+
+// resets so far, the n'th Reset drains the logs recorded before it into <outputDir>/phase_<n>
+var phases int
+
+// the runtime logs can only be counted by dumping them, Counts reports what the last dump or drain held
+var dumpedCounts map[string]int
+var dumpedAt int64
+
+type Instrumentation struct{}
+
+type InstrumentationDumpArgs struct {
+	Dir     string // directory the logs are written to, created if it does not exist
+	Message string // written to experiment_info.txt alongside the logs
+}
+
+type InstrumentationArgs struct{}
+
+type EventCounts struct {
+	Counts   map[string]int // events per log file since the last reset
+	Since    int64          // runtime timestamp of the last reset, 0 if never reset
+	Dir      string         // where Reset drained the logs recorded before it
+	DumpedAt int64          // when the runtime logs in Counts were dumped, 0 if they have not been since the reset
+}
+
+// Dump writes the current logs to a caller chosen directory without stopping the server
+func (in *Instrumentation) Dump(args InstrumentationDumpArgs, reply *EventCounts) error {
+	if args.Dir == "" {
+		return errors.New("a dump directory is required")
+	}
+	err := os.MkdirAll(args.Dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Dumping instrumentation logs to:", args.Dir)
+	counts, err := dumpInstrumentation(args.Dir, args.Message)
+	if err != nil {
+		return err
+	}
+	*reply = EventCounts{Counts: counts, Since: resetMark.Load()}
+	return nil
+}
+
+// Reset drains every log recorded since the previous reset into <outputDir>/phase_<n> and empties the
+// server's own buffers, so the next dump only has events from after this call. The runtime's exported
+// API has no way to empty its buffers, whatever it still holds is filtered out of later dumps by timestamp.
+// The phase stops at the reset's timestamp so no event ends up in both it and a later dump.
+func (in *Instrumentation) Reset(args InstrumentationArgs, reply *EventCounts) error {
+	dumpMu.Lock()
+	defer dumpMu.Unlock()
+
+	phases++
+	dir := filepath.Join(outputDir, fmt.Sprintf("phase_%d", phases))
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	mark := backend.NanotimeNow()
+	counts, err := dumpLogs(dir, mark)
+	if err != nil {
+		return err
+	}
+	resetMark.Store(mark)
+	trimTimeframes(mark)
+	trimRuntimeMetrics(mark)
+	dumpedCounts, dumpedAt = nil, 0
+
+	log.Printf("Instrumentation logs reset at: %d, earlier events drained to: %s\n", mark, dir)
+	*reply = EventCounts{Counts: counts, Since: mark, Dir: dir}
+	return nil
+}
+
+// Counts returns how many events each log holds since the last reset. The timeframes and runtime metrics
+// are counted where they are kept, the runtime logs as of the last dump since the reset.
+func (in *Instrumentation) Counts(args InstrumentationArgs, reply *EventCounts) error {
+	dumpMu.Lock()
+	defer dumpMu.Unlock()
+
+	since := resetMark.Load()
+	counts := make(map[string]int)
+	for _, l := range instrumentationLogs {
+		counts[l.file] = dumpedCounts[l.file]
+	}
+	counts["timeframe.jsonl"] = countTimeframes(since)
+	counts["runtime_metrics.jsonl"] = countRuntimeMetrics(since)
+	*reply = EventCounts{Counts: counts, Since: since, DumpedAt: dumpedAt}
+	return nil
+}
+
+/*
+
+	Experiment timeframes, recorded with the server's clock so they line up with the instrumentation timestamps
+
+*/
+
+type Timeframe struct {
+	Label string
+	Start int64
+	End   int64
+}
+
+var timeframesMu sync.Mutex
+var timeframes []Timeframe              // finished timeframes in the order they ended
+var openTimeframes = map[string]int64{} // label -> start of timeframes that have not ended yet
+
+type Experiment struct{}
+
+type ExperimentArgs struct {
+	Label string
+}
+
+// Begin starts the timeframe called args.Label and replies with its start timestamp
+func (e *Experiment) Begin(args ExperimentArgs, reply *int64) error {
+	timeframesMu.Lock()
+	defer timeframesMu.Unlock()
+
+	if _, open := openTimeframes[args.Label]; open {
+		return fmt.Errorf("timeframe %q has already begun", args.Label)
+	}
+	start := backend.NanotimeNow()
+	openTimeframes[args.Label] = start
+	log.Printf("Timeframe %q began at: %d\n", args.Label, start)
+
+	*reply = start
+	return nil
+}
+
+// End finishes the timeframe called args.Label and replies with its end timestamp
+func (e *Experiment) End(args ExperimentArgs, reply *int64) error {
+	end := backend.NanotimeNow()
+
+	timeframesMu.Lock()
+	defer timeframesMu.Unlock()
+
+	start, open := openTimeframes[args.Label]
+	if !open {
+		return fmt.Errorf("timeframe %q was never begun", args.Label)
+	}
+	delete(openTimeframes, args.Label)
+	timeframes = append(timeframes, Timeframe{args.Label, start, end})
+	log.Printf("Timeframe %q ended at: %d\n", args.Label, end)
+
+	*reply = end
+	return nil
+}
+
+// Now replies with the server's clock, so a client can put its own timestamps on the same clock as the logs
+func (e *Experiment) Now(args ExperimentArgs, reply *int64) error {
+	*reply = backend.NanotimeNow()
+	return nil
+}
+
+// trimTimeframes drops the finished timeframes that ended before mark, Reset has drained them
+func trimTimeframes(mark int64) {
+	timeframesMu.Lock()
+	defer timeframesMu.Unlock()
+
+	var kept []Timeframe
+	for _, tf := range timeframes {
+		if tf.End >= mark {
+			kept = append(kept, tf)
+		}
+	}
+	timeframes = kept
+}
+
+// countTimeframes is the number of finished timeframes that end at or after since
+func countTimeframes(since int64) int {
+	timeframesMu.Lock()
+	defer timeframesMu.Unlock()
+
+	count := 0
+	for _, tf := range timeframes {
+		if tf.End >= since {
+			count++
+		}
+	}
+	return count
+}
+
+// writeTimeframes writes every finished timeframe that ends at or after since and before until (0 for no limit) to path
+func writeTimeframes(path string, since int64, until int64) (int, error) {
+	timeframesMu.Lock()
+	defer timeframesMu.Unlock()
+
+	for label := range openTimeframes {
+		log.Printf("Timeframe %q has not ended and will not be dumped\n", label)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	count := 0
+	enc := json.NewEncoder(f)
+	for _, tf := range timeframes {
+		if tf.End < since || until != 0 && tf.End >= until {
+			continue
+		}
+		err = enc.Encode(tf)
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,5 @@
+module go-scheduling-under-the-hood/traceconv
+
+go 1.26.0
+
+require golang.org/x/exp v0.0.0-20260908205506-85c1c2202aba
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/exp/trace"
+)
+
+const helpMessage = `
+Usage:
+  ./traceconv [-out <directory>] [-run <run-id>] <trace file>
+
+Converts a runtime/trace capture of the server into instrumentation.jsonl and
+goroutine_status.jsonl so the client analyzers (-inst, -gstat) can be used on
+unmodified Go versions. Traces from Go 1.11 onwards can be read. The timestamps
+are the runtime's clock, the same one the server records its timeframes with.
+
+Options:
+  -out: Root directory the converted logs are written under (default ../json_results)
+  -run: Run ID, logs are written to <out>/<run-id>
+  `
+
+/*
+
+	Copy of important structs and constants from runtime/instrumentation_metrics.go
+
+*/
+
+const WAIT_REASON_NOOP = 66
+const STATUS_NOOP = 66
+
+const (
+	waitReasonZero                  uint8 = iota // ""
+	waitReasonGCAssistMarking                    // "GC assist marking"
+	waitReasonIOWait                             // "IO wait"
+	waitReasonChanReceiveNilChan                 // "chan receive (nil chan)"
+	waitReasonChanSendNilChan                    // "chan send (nil chan)"
+	waitReasonDumpingHeap                        // "dumping heap"
+	waitReasonGarbageCollection                  // "garbage collection"
+	waitReasonGarbageCollectionScan              // "garbage collection scan"
+	waitReasonPanicWait                          // "panicwait"
+	waitReasonSelect                             // "select"
+	waitReasonSelectNoCases                      // "select (no cases)"
+	waitReasonGCAssistWait                       // "GC assist wait"
+	waitReasonGCSweepWait                        // "GC sweep wait"
+	waitReasonGCScavengeWait                     // "GC scavenge wait"
+	waitReasonChanReceive                        // "chan receive"
+	waitReasonChanSend                           // "chan send"
+	waitReasonFinalizerWait                      // "finalizer wait"
+	waitReasonForceGCIdle                        // "force gc (idle)"
+	waitReasonSemacquire                         // "semacquire"
+	waitReasonSleep                              // "sleep"
+	waitReasonSyncCondWait                       // "sync.Cond.Wait"
+	waitReasonSyncMutexLock                      // "sync.Mutex.Lock"
+	waitReasonSyncRWMutexRLock                   // "sync.RWMutex.RLock"
+	waitReasonSyncRWMutexLock                    // "sync.RWMutex.Lock"
+	waitReasonTraceReaderBlocked                 // "trace reader (blocked)"
+	waitReasonWaitForGCCycle                     // "wait for GC cycle"
+	waitReasonGCWorkerIdle                       // "GC worker (idle)"
+	waitReasonGCWorkerActive                     // "GC worker (active)"
+	waitReasonPreempted                          // "preempted"
+	waitReasonDebugCall                          // "debug call"
+)
+
+const (
+	GOROUTINE_CREATION      int = 0
+	GOROUTINE_EXECUTION     int = 8
+	GOROUTINE_READY         int = 9
+	GOROUTINE_IDLE          int = 10
+	GOROUTINE_CHANGE_STATUS int = 11
+)
+
+const (
+	GIDLE      uint32 = 0
+	GRUNNABLE  uint32 = 1
+	GRUNNING   uint32 = 2
+	GSYSCALL   uint32 = 3
+	GWAITING   uint32 = 4
+	GDEAD      uint32 = 6
+	GPREEMPTED uint32 = 9
+)
+
+type SchedEvent struct {
+	Timestamp   int64 // timestamp (nanoseconds)
+	ActionID    int
+	GoRoutineID int64 // goroutine ID, ID:0 is the scheduler
+	ProcessorID int32 // processor ID
+}
+
+type ChangeEvent struct {
+	Timestamp   int64 // timestamp (nanoseconds)
+	ActionID    int
+	GoRoutineID int64  // goroutine ID, ID:0 is the scheduler
+	ProcessorID int32  // processor ID
+	OldStatus   uint32 // the status this goroutine moved from, 66 is a no-op (invalid)
+	NewStatus   uint32 // the status this goroutine moved from to, 66 is a no-op (invalid)
+	WaitReason  uint8  // (waitReason) Reason why the gorouine was put to wait if relevant action, 66 is a no-op (invalid)
+}
+
+// the tracer's block reasons mapped onto the closest entry of waitReasonStrings,
+// anything not listed becomes waitReasonZero
+var blockReasons = map[string]uint8{
+	"network":                      waitReasonIOWait,
+	"select":                       waitReasonSelect,
+	"forever":                      waitReasonSelectNoCases,
+	"chan send":                    waitReasonChanSend,
+	"chan receive":                 waitReasonChanReceive,
+	"sync":                         waitReasonSemacquire,
+	"sync.(*Cond).Wait":            waitReasonSyncCondWait,
+	"sleep":                        waitReasonSleep,
+	"preempted":                    waitReasonPreempted,
+	"GC mark assist wait for work": waitReasonGCAssistWait,
+	"GC background sweeper wait":   waitReasonGCSweepWait,
+	"wait until GC ends":           waitReasonWaitForGCCycle,
+	"wait for debug call":          waitReasonDebugCall,
+}
+
+func goStatus(s trace.GoState) uint32 {
+	switch s {
+	case trace.GoNotExist:
+		return GDEAD
+	case trace.GoRunnable:
+		return GRUNNABLE
+	case trace.GoRunning:
+		return GRUNNING
+	case trace.GoWaiting:
+		return GWAITING
+	case trace.GoSyscall:
+		return GSYSCALL
+	default:
+		return STATUS_NOOP
+	}
+}
+
+// convert reads every event of the trace and writes the goroutine transitions in the
+// SchedEvent and ChangeEvent schemas
+func convert(r io.Reader, inst *json.Encoder, gstat *json.Encoder) error {
+	tr, err := trace.NewReader(r)
+	if err != nil {
+		return err
+	}
+
+	for {
+		ev, err := tr.ReadEvent()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if ev.Kind() != trace.EventStateTransition {
+			continue
+		}
+		st := ev.StateTransition()
+		if st.Resource.Kind != trace.ResourceGoroutine {
+			continue
+		}
+		from, to := st.Goroutine()
+		if from == trace.GoUndetermined || from == to {
+			// the goroutine existed before the trace started, we do not know when it got here
+			continue
+		}
+
+		ts := int64(ev.Time())
+		gid := int64(st.Resource.Goroutine())
+		pid := int32(ev.Proc()) // -1 when no P was involved
+
+		action := -1
+		switch {
+		case from == trace.GoNotExist && to == trace.GoRunnable:
+			action = GOROUTINE_CREATION
+		case from == trace.GoRunnable && to == trace.GoRunning:
+			action = GOROUTINE_EXECUTION
+		case from == trace.GoWaiting && to == trace.GoRunnable:
+			action = GOROUTINE_READY
+		case from == trace.GoRunning && to == trace.GoWaiting:
+			action = GOROUTINE_IDLE
+		}
+		if action >= 0 {
+			err = inst.Encode(SchedEvent{ts, action, gid, pid})
+			if err != nil {
+				return err
+			}
+		}
+
+		changes := []ChangeEvent{{ts, GOROUTINE_CHANGE_STATUS, gid, pid, goStatus(from), goStatus(to), WAIT_REASON_NOOP}}
+		if to == trace.GoWaiting {
+			changes[0].WaitReason = blockReasons[st.Reason]
+		}
+		if from == trace.GoRunning && to == trace.GoRunnable && st.Reason == "preempted" {
+			// the instrumented runtime sees a preemption as running -> preempted -> runnable
+			changes = []ChangeEvent{
+				{ts, GOROUTINE_CHANGE_STATUS, gid, pid, GRUNNING, GPREEMPTED, waitReasonPreempted},
+				{ts, GOROUTINE_CHANGE_STATUS, gid, pid, GPREEMPTED, GRUNNABLE, WAIT_REASON_NOOP},
+			}
+		}
+		for _, c := range changes {
+			err = gstat.Encode(c)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func createLog(path string) (*os.File, *bufio.Writer, *json.Encoder) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	return f, w, json.NewEncoder(w)
+}
+
+func main() {
+	outRoot := flag.String("out", "../json_results", "root directory the converted logs are written under")
+	runID := flag.String("run", "", "run ID, logs are written to <out>/<run>")
+	flag.Usage = func() { fmt.Println(helpMessage) }
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		return
+	}
+
+	in, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer in.Close()
+
+	outputDir := filepath.Join(*outRoot, *runID)
+	err = os.MkdirAll(outputDir, 0755)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	instFile, instW, inst := createLog(filepath.Join(outputDir, "instrumentation.jsonl"))
+	defer instFile.Close()
+	gstatFile, gstatW, gstat := createLog(filepath.Join(outputDir, "goroutine_status.jsonl"))
+	defer gstatFile.Close()
+
+	err = convert(bufio.NewReader(in), inst, gstat)
+	if err != nil {
+		log.Fatal("Unable to convert trace: ", err)
+	}
+	if err := instW.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if err := gstatW.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Converted %s into %s\n", flag.Arg(0), outputDir)
+}